@@ -6,11 +6,21 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/like2foxes/chirpy/internal/api"
 	"github.com/like2foxes/chirpy/internal/database"
+	"github.com/like2foxes/chirpy/internal/keys"
+	"github.com/like2foxes/chirpy/internal/mail"
+	"github.com/like2foxes/chirpy/internal/password"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 )
 
+const schedulerInterval = 15 * time.Second
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -21,6 +31,14 @@ func main() {
 	port := os.Getenv("PORT")
 	databaseFile := os.Getenv("DATABASE_FILE")
 	jwtSecret := os.Getenv("JWT_SECRET")
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	jwtKeysDir := os.Getenv("JWT_KEYS_DIR")
+	jwtSigningKeyId := os.Getenv("JWT_SIGNING_KEY_ID")
+	jwtAcceptLegacyUntil := os.Getenv("JWT_ACCEPT_LEGACY_UNTIL")
+	mediaRoot := os.Getenv("MEDIA_ROOT")
+	if mediaRoot == "" {
+		mediaRoot = filepath.Join(filepath.Dir(filepath.Clean(fileRoot)), "media")
+	}
 
 	dbg := flag.Bool("debug", false, "enable debug mode")
 	flag.Parse()
@@ -32,8 +50,48 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if cost := os.Getenv("BCRYPT_COST"); cost != "" {
+		err = db.SetPasswordCost(intFromEnv("BCRYPT_COST", cost))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	passwordPolicy := password.NewPolicy(password.DefaultMinLength)
+	if minLength := os.Getenv("PASSWORD_MIN_LENGTH"); minLength != "" {
+		passwordPolicy.MinLength = intFromEnv("PASSWORD_MIN_LENGTH", minLength)
+	}
+	if breachedList := os.Getenv("PASSWORD_BREACHED_LIST"); breachedList != "" {
+		err = passwordPolicy.LoadBreachedList(breachedList)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	keyRing := keys.NewRing(jwtSecret)
+	if jwtKeysDir != "" {
+		err = keyRing.LoadDir(jwtKeysDir, jwtSigningKeyId)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go reloadKeysOnHangup(keyRing, jwtKeysDir, jwtSigningKeyId)
+	}
+	// Tokens signed with JWT_SECRET before the keys were configured keep
+	// working until this date, e.g. the rollout plus the refresh token
+	// lifetime, and are rejected after it.
+	if jwtAcceptLegacyUntil != "" {
+		until, err := time.Parse(time.DateOnly, jwtAcceptLegacyUntil)
+		if err != nil {
+			log.Fatal("JWT_ACCEPT_LEGACY_UNTIL must be a date like 2006-01-02")
+		}
+		keyRing.AcceptLegacyUntil(until)
+		log.Printf("Accepting legacy HS256 tokens until %s\n", jwtAcceptLegacyUntil)
+	}
+
+	apiCfg := api.NewApiConfig(keyRing, db, 0, mediaRoot, newMailer(), passwordPolicy, adminToken)
+	go apiCfg.RunScheduler(schedulerInterval)
+	apiCfg.ResumeMedia()
 
-	apiCfg := api.NewApiConfig(jwtSecret, db, 0)
 	fsHandler := apiCfg.MiddlewareMetricsInc(
 		http.StripPrefix(
 			"/app",
@@ -47,22 +105,104 @@ func main() {
 	r.Handle("/app/*", fsHandler)
 	r.Handle("/app", fsHandler)
 
+	r.Get("/.well-known/jwks.json", apiCfg.GetJWKS)
+
 	r.Mount("/api", apiRouter)
 	apiRouter.Get("/healthz", api.GetHealthz)
 	apiRouter.Get("/reset", apiCfg.GetReset)
-	apiRouter.Get("/chirps", apiCfg.GetChirps)
-	apiRouter.Get("/chirps/{id}", apiCfg.GetChirp)
-	apiRouter.Post("/chirps", apiCfg.PostChirp)
 	apiRouter.Get("/users", apiCfg.GetUsers)
-	apiRouter.Get("/users/{id}", apiCfg.GetUser)
 	apiRouter.Post("/users", apiCfg.PostUser)
 	apiRouter.Post("/login", apiCfg.PostLogin)
-	apiRouter.Put("/users", apiCfg.PutUser)
-	apiRouter.Post("/refresh", apiCfg.PostRefresh)
-	apiRouter.Post("/revoke", apiCfg.PostRevoke)
+	apiRouter.Post("/users/verify", apiCfg.PostUserVerify)
+	apiRouter.Post("/password/forgot", apiCfg.PostPasswordForgot)
+	apiRouter.Post("/password/reset", apiCfg.PostPasswordReset)
+	apiRouter.Get("/ws", apiCfg.GetWebSocket)
+	// API keys only reach the routes that declare one of their scopes.
+	chirpsWrite := apiCfg.RequireScope(api.ScopeChirpsWrite)
+	messagesRead := apiCfg.RequireScope(api.ScopeMessagesRead)
+	messagesWrite := apiCfg.RequireScope(api.ScopeMessagesWrite)
+	notificationsRead := apiCfg.RequireScope(api.ScopeNotificationsRead)
+
+	apiRouter.Group(func(r chi.Router) {
+		r.Use(apiCfg.OptionalAuth)
+		r.Use(apiCfg.RequireScope(api.ScopeChirpsRead))
+		r.Get("/chirps", apiCfg.GetChirps)
+		r.Get("/chirps/{id}", apiCfg.GetChirp)
+		r.Get("/chirps/{id}/poll", apiCfg.GetPoll)
+		r.Get("/media/{id}", apiCfg.GetMedia)
+		r.Get("/media/{id}/info", apiCfg.GetMediaInfo)
+		r.Get("/users/{id}", apiCfg.GetUser)
+		r.Get("/users/by-handle/{handle}", apiCfg.GetUserByHandle)
+		r.Get("/users/{id}/reactions", apiCfg.GetUserReactions)
+		r.Get("/lists", apiCfg.GetLists)
+		r.Get("/lists/{id}", apiCfg.GetList)
+		r.Get("/lists/{id}/chirps", apiCfg.GetListChirps)
+		r.Get("/stream", apiCfg.GetStream)
+	})
+	apiRouter.Group(func(r chi.Router) {
+		r.Use(apiCfg.RequireAuth)
+		r.With(chirpsWrite).Post("/chirps", apiCfg.PostChirp)
+		r.With(chirpsWrite).Delete("/chirps/{id}", apiCfg.DeleteChirp)
+		r.Post("/chirps/{id}/bookmark", apiCfg.PostBookmark)
+		r.Delete("/chirps/{id}/bookmark", apiCfg.DeleteBookmark)
+		r.With(chirpsWrite).Post("/chirps/{id}/poll/votes", apiCfg.PostPollVote)
+		r.With(chirpsWrite).Post("/chirps/{id}/reactions/{emoji}", apiCfg.PostReaction)
+		r.With(chirpsWrite).Delete("/chirps/{id}/reactions/{emoji}", apiCfg.DeleteReaction)
+		r.Get("/bookmarks", apiCfg.GetBookmarks)
+		r.Put("/users/me/pins", apiCfg.PutPins)
+		r.Delete("/users/me/pins", apiCfg.DeletePins)
+		r.Delete("/users/me/pins/{id}", apiCfg.DeletePin)
+		r.Post("/users/{id}/block", apiCfg.PostBlock)
+		r.Delete("/users/{id}/block", apiCfg.DeleteBlock)
+		r.Post("/users/{id}/mute", apiCfg.PostMute)
+		r.Delete("/users/{id}/mute", apiCfg.DeleteMute)
+		r.Post("/users/{id}/follow", apiCfg.PostFollow)
+		r.Delete("/users/{id}/follow", apiCfg.DeleteFollow)
+		r.Put("/users", apiCfg.PutUser)
+		r.Post("/users/verify/resend", apiCfg.PostUserVerifyResend)
+		r.Post("/users/me/2fa", apiCfg.PostTwoFactor)
+		r.Post("/users/me/2fa/confirm", apiCfg.PostTwoFactorConfirm)
+		r.Delete("/users/me/2fa", apiCfg.DeleteTwoFactor)
+		r.With(messagesWrite).Post("/conversations", apiCfg.PostConversation)
+		r.With(messagesRead).Get("/conversations", apiCfg.GetConversations)
+		r.With(messagesRead).Get("/conversations/{id}", apiCfg.GetConversation)
+		r.With(messagesWrite).Post("/conversations/{id}/messages", apiCfg.PostMessage)
+		r.With(messagesRead).Get("/conversations/{id}/messages", apiCfg.GetMessages)
+		r.With(messagesWrite).Post("/conversations/{id}/read", apiCfg.PostConversationRead)
+		r.With(chirpsWrite).Post("/drafts", apiCfg.PostDraft)
+		r.With(chirpsWrite).Get("/drafts", apiCfg.GetDrafts)
+		r.With(chirpsWrite).Get("/drafts/{id}", apiCfg.GetDraft)
+		r.With(chirpsWrite).Put("/drafts/{id}", apiCfg.PutDraft)
+		r.With(chirpsWrite).Delete("/drafts/{id}", apiCfg.DeleteDraft)
+		r.With(chirpsWrite).Post("/drafts/{id}/publish", apiCfg.PostDraftPublish)
+		r.Post("/lists", apiCfg.PostList)
+		r.Put("/lists/{id}", apiCfg.PutList)
+		r.Delete("/lists/{id}", apiCfg.DeleteList)
+		r.Post("/lists/{id}/members", apiCfg.PostListMember)
+		r.Delete("/lists/{id}/members/{userId}", apiCfg.DeleteListMember)
+		r.With(chirpsWrite).Post("/media", apiCfg.PostMedia)
+		r.With(notificationsRead).Get("/notifications", apiCfg.GetNotifications)
+		r.With(notificationsRead).Post("/notifications/read", apiCfg.PostNotificationsRead)
+		r.Get("/sessions", apiCfg.GetSessions)
+		r.Delete("/sessions", apiCfg.DeleteSessions)
+		r.Delete("/sessions/{id}", apiCfg.DeleteSession)
+		r.Post("/api-keys", apiCfg.PostApiKey)
+		r.Get("/api-keys", apiCfg.GetApiKeys)
+		r.Delete("/api-keys/{id}", apiCfg.DeleteApiKey)
+	})
+	apiRouter.Group(func(r chi.Router) {
+		r.Use(apiCfg.RequireTwoFactorChallenge)
+		r.Post("/login/2fa", apiCfg.PostLoginTwoFactor)
+	})
+	apiRouter.Group(func(r chi.Router) {
+		r.Use(apiCfg.RequireRefreshToken)
+		r.Post("/refresh", apiCfg.PostRefresh)
+		r.Post("/revoke", apiCfg.PostRevoke)
+	})
 
 	r.Mount("/admin", adminRouter)
 	adminRouter.Get("/metrics", apiCfg.GetMetrics)
+	adminRouter.With(apiCfg.RequireAdminToken).Post("/unlock", apiCfg.PostUnlock)
 
 	corsMux := api.MiddlewareCors(r)
 	server := &http.Server{
@@ -80,3 +220,44 @@ func onDebug(databaseFile string) {
 		log.Println(err)
 	}
 }
+
+func intFromEnv(name string, value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s must be an integer", name)
+	}
+	return n
+}
+
+// newMailer sends mail over SMTP when SMTP_ADDR is set. Otherwise messages
+// are written to MAIL_DIR, or logged when that is unset too.
+func newMailer() mail.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		return mail.SMTPMailer{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+	return mail.FileMailer{Dir: os.Getenv("MAIL_DIR"), From: from}
+}
+
+// reloadKeysOnHangup reloads the JWT keys on SIGHUP, so keys can be rotated
+// without a restart. A directory that fails to load keeps the current keys.
+func reloadKeysOnHangup(keyRing *keys.Ring, dir string, signingId string) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		err := keyRing.LoadDir(dir, signingId)
+		if err != nil {
+			log.Println("Error reloading JWT keys: " + err.Error())
+			continue
+		}
+		log.Println("JWT keys reloaded")
+	}
+}
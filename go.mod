@@ -9,4 +9,9 @@ require (
 	golang.org/x/crypto v0.15.0
 )
 
-require github.com/golang-jwt/jwt/v5 v5.1.0
+require (
+	github.com/golang-jwt/jwt/v5 v5.1.0
+	github.com/gorilla/websocket v1.5.1
+)
+
+require golang.org/x/net v0.17.0 // indirect
@@ -2,18 +2,59 @@ package api
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"github.com/like2foxes/chirpy/internal/database"
+	"github.com/like2foxes/chirpy/internal/events"
+	"github.com/like2foxes/chirpy/internal/keys"
+	"github.com/like2foxes/chirpy/internal/lockout"
+	"github.com/like2foxes/chirpy/internal/mail"
+	"github.com/like2foxes/chirpy/internal/password"
+	"github.com/like2foxes/chirpy/internal/stream"
 )
 
 type ApiConfig struct {
 	fileserverHits int
-	jwtSecret      string
+	keys           *keys.Ring
 	db             *database.DB
+	mediaRoot      string
+	mailer         mail.Mailer
+	passwordPolicy *password.Policy
+	dummyHash      string
+	accountLocks   *lockout.Tracker
+	ipLocks        *lockout.Tracker
+	adminToken     string
+	mediaWorkers   chan struct{}
+	events         *events.Bus
+	stream         *stream.Broker
+	hub            *stream.Hub
 }
 
-func NewApiConfig(jwtSecret string, db *database.DB, fileserverHits int) *ApiConfig {
-	return &ApiConfig{fileserverHits, jwtSecret, db}
+func NewApiConfig(keyRing *keys.Ring, db *database.DB, fileserverHits int, mediaRoot string, mailer mail.Mailer, passwordPolicy *password.Policy, adminToken string) *ApiConfig {
+	dummyHash, err := db.HashPassword("chirpy-dummy-password")
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := &ApiConfig{
+		fileserverHits: fileserverHits,
+		keys:           keyRing,
+		db:             db,
+		mediaRoot:      mediaRoot,
+		mailer:         mailer,
+		passwordPolicy: passwordPolicy,
+		dummyHash:      dummyHash,
+		accountLocks:   lockout.NewTracker(accountLockoutPolicy),
+		ipLocks:        lockout.NewTracker(ipLockoutPolicy),
+		adminToken:     adminToken,
+		mediaWorkers:   make(chan struct{}, maxMediaWorkers),
+		events:         events.NewBus(),
+		stream:         stream.NewBroker(streamHistorySize),
+		hub:            stream.NewHub(wsClientBuffer),
+	}
+	c.events.Subscribe(c.notifyOnEvent)
+	c.events.Subscribe(c.streamOnEvent)
+	c.events.Subscribe(c.wsOnEvent)
+	return c
 }
 
 func (c *ApiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/like2foxes/chirpy/internal/database"
+)
+
+// apiKeyPrefix marks bearer credentials that are API keys rather than
+// JWTs, and makes leaked keys easy to scan for.
+const apiKeyPrefix = "chirpy_"
+
+const (
+	ScopeChirpsRead        = "chirps:read"
+	ScopeChirpsWrite       = "chirps:write"
+	ScopeMessagesRead      = "messages:read"
+	ScopeMessagesWrite     = "messages:write"
+	ScopeNotificationsRead = "notifications:read"
+
+	maxApiKeyNameLength = 64
+)
+
+var apiKeyScopes = []string{
+	ScopeChirpsRead,
+	ScopeChirpsWrite,
+	ScopeMessagesRead,
+	ScopeMessagesWrite,
+	ScopeNotificationsRead,
+}
+
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type apiKeyResponse struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type createdApiKeyResponse struct {
+	apiKeyResponse
+	// Key is only returned when the key is created.
+	Key string `json:"key"`
+}
+
+// PostApiKey creates an API key for the user. API keys cannot manage API
+// keys, so a leaked key cannot mint more.
+func (c ApiConfig) PostApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var req apiKeyRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxApiKeyNameLength {
+		badRequestError(w, fmt.Errorf("name must be 1-%d characters", maxApiKeyNameLength))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		badRequestError(w, errors.New("at least one scope is required"))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			badRequestError(w, fmt.Errorf("unknown scope %q", scope))
+			return
+		}
+	}
+	slices.Sort(req.Scopes)
+	req.Scopes = slices.Compact(req.Scopes)
+
+	secret, err := newTokenId()
+	if err != nil {
+		internalServerError(w, err)
+		return
+	}
+	key := apiKeyPrefix + secret
+	record, err := c.db.CreateApiKey(database.ApiKey{
+		UserId:  userId,
+		Name:    req.Name,
+		Prefix:  key[:len(apiKeyPrefix)+6],
+		KeyHash: hashToken(key),
+		Scopes:  req.Scopes,
+	})
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, createdApiKeyResponse{
+		apiKeyResponse: newApiKeyResponse(record),
+		Key:            key,
+	})
+}
+
+func (c ApiConfig) GetApiKeys(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := c.db.GetApiKeys(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	response := []apiKeyResponse{}
+	for _, key := range keys {
+		response = append(response, newApiKeyResponse(key))
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c ApiConfig) DeleteApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.db.DeleteApiKey(id, userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+// authenticateApiKey looks up the key and returns a principal limited to
+// its scopes.
+func (c ApiConfig) authenticateApiKey(key string) (Principal, error) {
+	record, err := c.db.UseApiKey(hashToken(key))
+	if err != nil && err.Error() == "not found" {
+		return Principal{}, errors.New("unknown api key")
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{
+		UserId:   record.UserId,
+		ApiKeyId: record.Id,
+		Scopes:   record.Scopes,
+	}, nil
+}
+
+func newApiKeyResponse(key database.ApiKey) apiKeyResponse {
+	return apiKeyResponse{
+		Id:         key.Id,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	issuerAccess    = "chirpy-access"
+	issuerRefresh   = "chirpy-refresh"
+	issuerChallenge = "chirpy-2fa-challenge"
+)
+
+// tokenClaims are the claims of the tokens chirpy issues. Access tokens
+// name the session they belong to, so ending a session also ends its
+// access tokens instead of leaving them valid until they expire.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	SessionId string `json:"sid,omitempty"`
+}
+
+// Principal is the authenticated caller of a request, as established by
+// the auth middlewares from its bearer token or API key.
+type Principal struct {
+	UserId int
+	// Token is the raw bearer token and TokenId its jti, which is empty
+	// for access tokens. Both are empty for API keys.
+	Token     string
+	TokenId   string
+	Issuer    string
+	ExpiresAt time.Time
+	// ApiKeyId is set when the caller used an API key, which only grants
+	// its Scopes. Tokens from a login grant everything.
+	ApiKeyId int
+	Scopes   []string
+}
+
+// HasScope reports whether the principal may act within scope.
+func (p Principal) HasScope(scope string) bool {
+	return p.ApiKeyId == 0 || slices.Contains(p.Scopes, scope)
+}
+
+type principalContextKey struct{}
+
+// scopeCheckedContextKey marks requests that passed RequireScope, so
+// userIdFromRequest can turn API keys away from routes that declare no
+// scope.
+type scopeCheckedContextKey struct{}
+
+// PrincipalFromContext returns the principal the auth middlewares stored
+// in the request context, if the request was authenticated.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(Principal)
+	return principal, ok
+}
+
+// RequireAuth rejects requests without a valid access token.
+func (c ApiConfig) RequireAuth(next http.Handler) http.Handler {
+	return c.authMiddleware(issuerAccess, true)(next)
+}
+
+// OptionalAuth authenticates requests that carry an access token and lets
+// anonymous requests through. A token that is present but invalid is
+// still rejected rather than silently ignored.
+func (c ApiConfig) OptionalAuth(next http.Handler) http.Handler {
+	return c.authMiddleware(issuerAccess, false)(next)
+}
+
+// RequireRefreshToken rejects requests without a valid refresh token.
+func (c ApiConfig) RequireRefreshToken(next http.Handler) http.Handler {
+	return c.authMiddleware(issuerRefresh, true)(next)
+}
+
+// RequireTwoFactorChallenge rejects requests without a valid challenge
+// token from the first step of a two-factor login.
+func (c ApiConfig) RequireTwoFactorChallenge(next http.Handler) http.Handler {
+	return c.authMiddleware(issuerChallenge, true)(next)
+}
+
+// RequireAdminToken guards operator endpoints with the ADMIN_TOKEN secret.
+// They are disabled when no token is configured.
+func (c ApiConfig) RequireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := bearerToken(r)
+		if err != nil {
+			autherizationHeaderError(w, err)
+			return
+		}
+		if c.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(c.adminToken)) != 1 {
+			autherizationHeaderError(w, errors.New("invalid admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope limits API keys to routes within their scopes. Login tokens
+// and anonymous requests pass through; whether a route needs a user at all
+// is up to the auth middleware in front of it.
+func (c ApiConfig) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if ok && !principal.HasScope(scope) {
+				forbiddenError(w, fmt.Errorf("api key lacks the %s scope", scope))
+				return
+			}
+			ctx := context.WithValue(r.Context(), scopeCheckedContextKey{}, true)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func (c ApiConfig) authMiddleware(issuer string, required bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !required && r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tokenString, err := bearerToken(r)
+			if err != nil {
+				autherizationHeaderError(w, err)
+				return
+			}
+			var principal Principal
+			if issuer == issuerAccess && strings.HasPrefix(tokenString, apiKeyPrefix) {
+				principal, err = c.authenticateApiKey(tokenString)
+			} else {
+				principal, err = c.authenticate(tokenString, issuer)
+			}
+			if err != nil {
+				tokenParsingError(w, err)
+				return
+			}
+			ctx := context.WithValue(r.Context(), principalContextKey{}, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authenticate verifies the signature, issuer and expiry of a token and
+// checks it has not been revoked and its session, if it names one, is
+// still active.
+func (c ApiConfig) authenticate(tokenString string, issuer string) (Principal, error) {
+	claims := tokenClaims{}
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		c.keys.Keyfunc,
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return Principal{}, err
+	}
+	userId, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return Principal{}, errors.New("invalid token subject")
+	}
+	if c.keys.IsLegacy(token) {
+		log.Printf("Accepted legacy HS256 %s token for user %d\n", issuer, userId)
+	}
+	if c.db.IsTokenRevoked(tokenString) || (claims.ID != "" && c.db.IsTokenRevoked(claims.ID)) {
+		return Principal{}, errors.New("token is revoked")
+	}
+	if claims.SessionId != "" {
+		active, err := c.db.HasSession(claims.SessionId)
+		if err != nil {
+			return Principal{}, err
+		}
+		if !active {
+			return Principal{}, errors.New("session has ended")
+		}
+	}
+	return Principal{
+		UserId:    userId,
+		Token:     tokenString,
+		TokenId:   claims.ID,
+		Issuer:    claims.Issuer,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", errors.New("no authorization header")
+	}
+	scheme, token, ok := strings.Cut(authHeader, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", errors.New("invalid authorization header")
+	}
+	return token, nil
+}
+
+// userIdFromRequest returns the id of the authenticated user. Routes using
+// it must be behind RequireAuth; without a principal it fails closed. API
+// keys are rejected unless the route declared a scope with RequireScope.
+func userIdFromRequest(w http.ResponseWriter, r *http.Request) (int, bool) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		autherizationHeaderError(w, errors.New("request is not authenticated"))
+		return 0, false
+	}
+	if principal.ApiKeyId != 0 && r.Context().Value(scopeCheckedContextKey{}) == nil {
+		forbiddenError(w, errors.New("api keys cannot use this endpoint"))
+		return 0, false
+	}
+	return principal.UserId, true
+}
+
+// viewerIdFromRequest is the optional variant of userIdFromRequest for
+// routes behind OptionalAuth: it returns 0 for anonymous requests.
+func viewerIdFromRequest(r *http.Request) int {
+	principal, _ := PrincipalFromContext(r.Context())
+	return principal.UserId
+}
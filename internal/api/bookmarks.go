@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+)
+
+func (c ApiConfig) PostBookmark(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	chirpId, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	bookmark, err := c.db.CreateBookmark(userId, chirpId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, bookmark)
+}
+
+func (c ApiConfig) DeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	chirpId, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.db.DeleteBookmark(userId, chirpId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+func (c ApiConfig) GetBookmarks(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, ok := paginationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	chirps, err := c.db.GetBookmarkedChirps(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, paginate(chirps, limit, offset))
+}
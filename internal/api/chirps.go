@@ -2,11 +2,20 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/like2foxes/chirpy/internal/database"
+	"github.com/like2foxes/chirpy/internal/events"
 )
 
 type chirp struct {
-	Body string `json:"body"`
+	Body         string       `json:"body"`
+	ReplyToId    *int         `json:"reply_to_id,omitempty"`
+	Visibility   string       `json:"visibility,omitempty"`
+	RecipientIds []int        `json:"recipient_ids,omitempty"`
+	MediaIds     []int        `json:"media_ids,omitempty"`
+	Poll         *pollRequest `json:"poll,omitempty"`
 }
 
 type chirpError struct {
@@ -18,17 +27,27 @@ type chirpValid struct {
 }
 
 func (c ApiConfig) GetChirps(w http.ResponseWriter, r *http.Request) {
-	chirps, err := c.db.GetChirps()
+	viewerId := viewerIdFromRequest(r)
+	chirps, err := c.db.GetVisibleChirps(viewerId)
 	if err != nil {
 		queryError(w, err)
 		return
 	}
+	if viewerId != 0 {
+		hidden, err := c.db.GetHiddenAuthorIds(viewerId)
+		if err != nil {
+			queryError(w, err)
+			return
+		}
+		chirps = filterChirpsByAuthor(chirps, hidden)
+	}
 	respondWithJSON(w, http.StatusOK, chirps)
 }
 
 func (c ApiConfig) GetChirp(w http.ResponseWriter, r *http.Request) {
+	viewerId := viewerIdFromRequest(r)
 	if id, ok := idFromURL(w, r); ok {
-		chirp, err := c.db.GetChirp(id)
+		chirp, err := c.db.GetVisibleChirp(id, viewerId)
 		if err != nil {
 			queryError(w, err)
 			return
@@ -38,22 +57,149 @@ func (c ApiConfig) GetChirp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c ApiConfig) PostChirp(w http.ResponseWriter, r *http.Request) {
+	authorId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+
 	var ch chirp
 	if !decodeItemOr404(w, r, &ch) {
 		return
 	}
 
+	newChrip, err := c.createChirp(authorId, ch)
+	if err != nil {
+		requestOrQueryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, newChrip)
+}
+
+// validateChirp checks a chirp request on behalf of its author and builds
+// the chirp that would be stored. Drafts and the scheduler go through it
+// too, so scheduled chirps get exactly the checks PostChirp does.
+func (c ApiConfig) validateChirp(authorId int, ch chirp) (database.Chirp, error) {
 	if len(ch.Body) > 140 {
-		chirpLengthError(w, errors.New("Chirp is too long"))
+		return database.Chirp{}, requestError{http.StatusBadRequest, "Chirp is too long"}
+	}
+
+	if ch.Visibility == "" {
+		ch.Visibility = database.VisibilityPublic
+	}
+	if !database.IsValidVisibility(ch.Visibility) {
+		return database.Chirp{}, requestError{http.StatusBadRequest, "invalid visibility"}
+	}
+	if ch.Visibility != database.VisibilityDirect && len(ch.RecipientIds) > 0 {
+		return database.Chirp{}, requestError{http.StatusBadRequest, "recipients are only allowed on direct chirps"}
+	}
+
+	if len(ch.MediaIds) > maxMediaPerChirp {
+		return database.Chirp{}, requestError{
+			http.StatusBadRequest,
+			fmt.Sprintf("a chirp can have at most %d attachments", maxMediaPerChirp),
+		}
+	}
+
+	var poll *database.Poll
+	if ch.Poll != nil {
+		p, err := ch.Poll.toPoll()
+		if err != nil {
+			return database.Chirp{}, requestError{http.StatusBadRequest, err.Error()}
+		}
+		poll = &p
+	}
+
+	if ch.ReplyToId != nil {
+		parent, err := c.db.GetVisibleChirp(*ch.ReplyToId, authorId)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+		blocked, err := c.db.IsBlockedBetween(authorId, parent.AuthorId)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+		if blocked {
+			return database.Chirp{}, requestError{http.StatusForbidden, "cannot reply to a user who blocked you"}
+		}
+	}
+
+	return database.Chirp{
+		Body:         cleanData(ch.Body),
+		AuthorId:     authorId,
+		ReplyToId:    ch.ReplyToId,
+		Visibility:   ch.Visibility,
+		RecipientIds: ch.RecipientIds,
+		MediaIds:     ch.MediaIds,
+		Poll:         poll,
+	}, nil
+}
+
+func (c ApiConfig) createChirp(authorId int, ch chirp) (database.Chirp, error) {
+	author, err := c.db.GetUser(authorId)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if !author.Verified {
+		return database.Chirp{}, requestError{http.StatusForbidden, "email address is not verified"}
+	}
+
+	newChirp, err := c.validateChirp(authorId, ch)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	newChirp, err = c.db.CreateChirp(newChirp)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	c.events.Publish(events.Event{
+		Type:    events.ChirpCreated,
+		ActorId: authorId,
+		Chirp:   &newChirp,
+	})
+	return newChirp, nil
+}
+
+func (c ApiConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
 		return
 	}
 
-	cleaned := cleanData(ch.Body)
+	// Chirps the user cannot see are not found, so deleting does not reveal
+	// that they exist.
+	chirp, err := c.db.GetVisibleChirp(id, userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	if chirp.AuthorId != userId {
+		forbiddenError(w, errors.New("user is not the author of the chirp"))
+		return
+	}
 
-	newChrip, err := c.db.CreateChirp(cleaned)
+	err = c.db.DeleteChirp(id)
 	if err != nil {
 		queryError(w, err)
 		return
 	}
-	respondWithJSON(w, http.StatusCreated, newChrip)
+	c.events.Publish(events.Event{
+		Type:    events.ChirpDeleted,
+		ActorId: userId,
+		Chirp:   &chirp,
+	})
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+func filterChirpsByAuthor(chirps []database.Chirp, hidden map[int]bool) []database.Chirp {
+	filtered := []database.Chirp{}
+	for _, chirp := range chirps {
+		if !hidden[chirp.AuthorId] {
+			filtered = append(filtered, chirp)
+		}
+	}
+	return filtered
 }
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/like2foxes/chirpy/internal/events"
+)
+
+const maxMessageLength = 1000
+
+type conversationRequest struct {
+	ParticipantIds []int `json:"participant_ids"`
+}
+
+type messageRequest struct {
+	Body string `json:"body"`
+}
+
+func (c ApiConfig) PostConversation(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var req conversationRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	conversation, err := c.db.CreateConversation(userId, req.ParticipantIds)
+	if err != nil {
+		switch err.Error() {
+		case "user is blocked":
+			forbiddenError(w, err)
+		case "a conversation needs at least two participants":
+			badRequestError(w, err)
+		default:
+			queryError(w, err)
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, conversation)
+}
+
+func (c ApiConfig) GetConversations(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, ok := paginationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	conversations, err := c.db.GetConversations(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, paginate(conversations, limit, offset))
+}
+
+func (c ApiConfig) GetConversation(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	conversation, err := c.db.GetConversation(id, userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, conversation)
+}
+
+func (c ApiConfig) PostMessage(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	var req messageRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		badRequestError(w, errors.New("message body is empty"))
+		return
+	}
+	if len(req.Body) > maxMessageLength {
+		badRequestError(w, errors.New("message is too long"))
+		return
+	}
+
+	message, err := c.db.CreateMessage(id, userId, req.Body)
+	if err != nil && err.Error() == "user is blocked" {
+		forbiddenError(w, err)
+		return
+	}
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	conversation, err := c.db.GetConversation(id, userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	recipientIds := []int{}
+	for _, participant := range conversation.Participants {
+		if participant.UserId != userId {
+			recipientIds = append(recipientIds, participant.UserId)
+		}
+	}
+	c.events.Publish(events.Event{
+		Type:         events.MessageCreated,
+		ActorId:      userId,
+		Message:      &message,
+		RecipientIds: recipientIds,
+	})
+	respondWithJSON(w, http.StatusCreated, message)
+}
+
+func (c ApiConfig) GetMessages(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, ok := paginationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	messages, err := c.db.GetMessages(id, userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, paginate(messages, limit, offset))
+}
+
+func (c ApiConfig) PostConversationRead(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	receipt, err := c.db.MarkConversationRead(id, userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, receipt)
+}
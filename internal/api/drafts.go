@@ -0,0 +1,264 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/like2foxes/chirpy/internal/database"
+)
+
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+type draft struct {
+	chirp
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+}
+
+func (c ApiConfig) PostDraft(w http.ResponseWriter, r *http.Request) {
+	authorId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var d draft
+	if !decodeItemOr404(w, r, &d) {
+		return
+	}
+
+	err := c.validateDraft(authorId, d)
+	if err != nil {
+		requestOrQueryError(w, err)
+		return
+	}
+	created, err := c.db.CreateDraft(newDatabaseDraft(authorId, d))
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (c ApiConfig) GetDrafts(w http.ResponseWriter, r *http.Request) {
+	authorId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, ok := paginationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	drafts, err := c.db.GetDrafts(authorId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	if scheduled := r.URL.Query().Get("scheduled"); scheduled != "" {
+		wantScheduled := scheduled == "true"
+		filtered := []database.Draft{}
+		for _, d := range drafts {
+			if (d.PublishAt != nil) == wantScheduled {
+				filtered = append(filtered, d)
+			}
+		}
+		drafts = filtered
+	}
+	respondWithJSON(w, http.StatusOK, paginate(drafts, limit, offset))
+}
+
+func (c ApiConfig) GetDraft(w http.ResponseWriter, r *http.Request) {
+	authorId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	d, err := c.db.GetDraft(id, authorId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, d)
+}
+
+func (c ApiConfig) PutDraft(w http.ResponseWriter, r *http.Request) {
+	authorId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	var d draft
+	if !decodeItemOr404(w, r, &d) {
+		return
+	}
+
+	err := c.validateDraft(authorId, d)
+	if err != nil {
+		requestOrQueryError(w, err)
+		return
+	}
+	updated := newDatabaseDraft(authorId, d)
+	updated.Id = id
+	updated, err = c.db.UpdateDraft(updated)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (c ApiConfig) DeleteDraft(w http.ResponseWriter, r *http.Request) {
+	authorId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.db.DeleteDraft(id, authorId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+func (c ApiConfig) PostDraftPublish(w http.ResponseWriter, r *http.Request) {
+	authorId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Taking the draft out first means a second request, or the scheduler,
+	// cannot publish it again.
+	d, err := c.db.TakeDraft(id, authorId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	published, err := c.createChirp(d.AuthorId, chirpFromDraft(d))
+	if err != nil {
+		c.restoreDraft(d)
+		requestOrQueryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, published)
+}
+
+// RunScheduler publishes scheduled drafts once their publish time has
+// passed, checking every interval. It blocks and is meant to be started in
+// its own goroutine.
+func (c ApiConfig) RunScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.publishDueDrafts(time.Now().UTC())
+	}
+}
+
+func (c ApiConfig) publishDueDrafts(now time.Time) {
+	drafts, err := c.db.GetDueDrafts(now)
+	if err != nil {
+		log.Printf("Error loading scheduled drafts: %s\n", err.Error())
+		return
+	}
+	for _, due := range drafts {
+		d, err := c.db.TakeDueDraft(due.Id, now)
+		if err != nil {
+			// Published, deleted or rescheduled since it was loaded.
+			if err.Error() != "not found" {
+				log.Printf("Error taking draft %d: %s\n", due.Id, err.Error())
+			}
+			continue
+		}
+		_, err = c.createChirp(d.AuthorId, chirpFromDraft(d))
+		if err == nil {
+			continue
+		}
+		log.Printf("Error publishing draft %d: %s\n", d.Id, err.Error())
+		d.PublishAt = nil
+		d.PublishError = err.Error()
+		d.UpdatedAt = time.Now().UTC()
+		c.restoreDraft(d)
+	}
+}
+
+// restoreDraft puts back a draft that failed to publish. The failure is
+// only logged, since the caller reports the publishing error.
+func (c ApiConfig) restoreDraft(d database.Draft) {
+	_, err := c.db.RestoreDraft(d)
+	if err != nil {
+		log.Printf("Error restoring draft %d: %s\n", d.Id, err.Error())
+	}
+}
+
+func (c ApiConfig) validateDraft(authorId int, d draft) error {
+	if d.PublishAt != nil {
+		now := time.Now().UTC()
+		if !d.PublishAt.After(now) {
+			return requestError{http.StatusBadRequest, "publish_at must be in the future"}
+		}
+		if d.PublishAt.After(now.Add(maxScheduleAhead)) {
+			return requestError{http.StatusBadRequest, "publish_at is too far in the future"}
+		}
+	}
+	_, err := c.validateChirp(authorId, d.chirp)
+	return err
+}
+
+func newDatabaseDraft(authorId int, d draft) database.Draft {
+	var poll *database.DraftPoll
+	if d.Poll != nil {
+		poll = &database.DraftPoll{
+			Options:          d.Poll.Options,
+			Multiple:         d.Poll.Multiple,
+			ExpiresInSeconds: d.Poll.ExpiresInSeconds,
+		}
+	}
+	var publishAt *time.Time
+	if d.PublishAt != nil {
+		utc := d.PublishAt.UTC()
+		publishAt = &utc
+	}
+	return database.Draft{
+		AuthorId:     authorId,
+		Body:         d.Body,
+		ReplyToId:    d.ReplyToId,
+		Visibility:   d.Visibility,
+		RecipientIds: d.RecipientIds,
+		MediaIds:     d.MediaIds,
+		Poll:         poll,
+		PublishAt:    publishAt,
+	}
+}
+
+func chirpFromDraft(d database.Draft) chirp {
+	var poll *pollRequest
+	if d.Poll != nil {
+		poll = &pollRequest{
+			Options:          d.Poll.Options,
+			Multiple:         d.Poll.Multiple,
+			ExpiresInSeconds: d.Poll.ExpiresInSeconds,
+		}
+	}
+	return chirp{
+		Body:         d.Body,
+		ReplyToId:    d.ReplyToId,
+		Visibility:   d.Visibility,
+		RecipientIds: d.RecipientIds,
+		MediaIds:     d.MediaIds,
+		Poll:         poll,
+	}
+}
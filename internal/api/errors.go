@@ -1,7 +1,11 @@
 package api
 import (
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func queryError(w http.ResponseWriter, err error) {
@@ -24,6 +28,21 @@ func tokenParsingError(w http.ResponseWriter, err error) {
 	respondWithError(w, http.StatusUnauthorized, "invalid credentials")
 }
 
+func badRequestError(w http.ResponseWriter, err error) {
+	log.Printf("Error: %s\n", err.Error())
+	respondWithError(w, http.StatusBadRequest, err.Error())
+}
+
+func forbiddenError(w http.ResponseWriter, err error) {
+	log.Printf("Error: %s\n", err.Error())
+	respondWithError(w, http.StatusForbidden, "forbidden")
+}
+
+func conflictError(w http.ResponseWriter, err error) {
+	log.Printf("Error: %s\n", err.Error())
+	respondWithError(w, http.StatusConflict, err.Error())
+}
+
 func internalServerError(w http.ResponseWriter, err error) {
 	log.Printf("Error: %s\n", err.Error())
 	respondWithError(w, http.StatusInternalServerError, "internal server error")
@@ -39,7 +58,36 @@ func conversionError(w http.ResponseWriter, err error) {
 	respondWithError(w, http.StatusInternalServerError, "internal server error")
 }
 
-func chirpLengthError(w http.ResponseWriter, err error) {
-	log.Printf("Error: %s\n", err.Error())
-	respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+// requestError carries the response for a validation failure detected
+// outside of a handler.
+type requestError struct {
+	status int
+	msg    string
+}
+
+func (e requestError) Error() string {
+	return e.msg
+}
+
+func requestOrQueryError(w http.ResponseWriter, err error) {
+	var reqErr requestError
+	if errors.As(err, &reqErr) {
+		log.Printf("Error: %s\n", reqErr.msg)
+		respondWithError(w, reqErr.status, reqErr.msg)
+		return
+	}
+	queryError(w, err)
+}
+
+func paginationError(w http.ResponseWriter, err error) {
+	log.Printf("Error parsing pagination: %s\n", err.Error())
+	respondWithError(w, http.StatusBadRequest, "invalid pagination parameters")
+}
+
+// tooManyRequestsError tells the client how long to wait before retrying.
+func tooManyRequestsError(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	log.Printf("Error: too many requests, retry after %ds\n", seconds)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, "too many attempts, try again later")
 }
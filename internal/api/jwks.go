@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+)
+
+// jwksMaxAge is how long verifiers may cache the key set. A new signing key
+// must be published at least this long before tokens are signed with it.
+const jwksMaxAge = "max-age=300"
+
+// GetJWKS publishes the public keys tokens are verified with, so other
+// services can check chirpy tokens without holding a signing secret.
+func (c ApiConfig) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", jwksMaxAge)
+	respondWithJSON(w, http.StatusOK, c.keys.JWKS())
+}
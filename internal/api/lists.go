@@ -0,0 +1,223 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/like2foxes/chirpy/internal/database"
+)
+
+const maxListNameLength = 50
+
+type listRequest struct {
+	Name    string `json:"name"`
+	Private bool   `json:"private"`
+}
+
+type listMemberRequest struct {
+	UserId int `json:"user_id"`
+}
+
+func (l *listRequest) validate() error {
+	l.Name = strings.TrimSpace(l.Name)
+	if l.Name == "" {
+		return errors.New("list name is empty")
+	}
+	if utf8.RuneCountInString(l.Name) > maxListNameLength {
+		return fmt.Errorf("list name is longer than %d characters", maxListNameLength)
+	}
+	return nil
+}
+
+func (c ApiConfig) PostList(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var req listRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		badRequestError(w, err)
+		return
+	}
+
+	list, err := c.db.CreateList(database.List{
+		OwnerId: userId,
+		Name:    req.Name,
+		Private: req.Private,
+	})
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, list)
+}
+
+// GetLists returns the lists of the user given by the owner_id query
+// parameter, or the caller's own lists when it is omitted.
+func (c ApiConfig) GetLists(w http.ResponseWriter, r *http.Request) {
+	viewerId := viewerIdFromRequest(r)
+	ownerId := viewerId
+	if owner := r.URL.Query().Get("owner_id"); owner != "" {
+		var ok bool
+		ownerId, ok = intFromQuery(w, owner)
+		if !ok {
+			return
+		}
+	}
+	if ownerId == 0 {
+		autherizationHeaderError(w, errors.New("no authorization header"))
+		return
+	}
+
+	lists, err := c.db.GetLists(ownerId, viewerId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, lists)
+}
+
+func (c ApiConfig) GetList(w http.ResponseWriter, r *http.Request) {
+	viewerId := viewerIdFromRequest(r)
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := c.db.GetList(id, viewerId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+func (c ApiConfig) PutList(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	var req listRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		badRequestError(w, err)
+		return
+	}
+
+	list, err := c.db.UpdateList(id, userId, req.Name, req.Private)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+func (c ApiConfig) DeleteList(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.db.DeleteList(id, userId)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+func (c ApiConfig) PostListMember(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	var req listMemberRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	list, err := c.db.AddListMember(id, userId, req.UserId)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+func (c ApiConfig) DeleteListMember(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	memberId, ok := intFromURL(w, r, "userId")
+	if !ok {
+		return
+	}
+
+	list, err := c.db.RemoveListMember(id, userId, memberId)
+	if err != nil {
+		listError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+func (c ApiConfig) GetListChirps(w http.ResponseWriter, r *http.Request) {
+	viewerId := viewerIdFromRequest(r)
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, ok := paginationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	chirps, err := c.db.GetListChirps(id, viewerId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	if viewerId != 0 {
+		hidden, err := c.db.GetHiddenAuthorIds(viewerId)
+		if err != nil {
+			queryError(w, err)
+			return
+		}
+		chirps = filterChirpsByAuthor(chirps, hidden)
+	}
+	respondWithJSON(w, http.StatusOK, paginate(chirps, limit, offset))
+}
+
+func listError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "forbidden", "user is blocked":
+		forbiddenError(w, err)
+	default:
+		queryError(w, err)
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/like2foxes/chirpy/internal/lockout"
+)
+
+// Accounts get a few attempts before backoff and are locked after ten
+// failures. Clients get more room, since several users may share an
+// address, but one address cannot work through many accounts.
+var (
+	accountLockoutPolicy = lockout.Policy{
+		FreeAttempts:    5,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAttempts: 10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	ipLockoutPolicy = lockout.Policy{
+		FreeAttempts:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAttempts: 100,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+)
+
+type unlockRequest struct {
+	Email string `json:"email"`
+	Ip    string `json:"ip"`
+}
+
+// PostUnlock clears the failed login attempts of an account, a client
+// address or both. It answers the same way whether or not the account
+// exists.
+func (c ApiConfig) PostUnlock(w http.ResponseWriter, r *http.Request) {
+	var req unlockRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+	if req.Email == "" && req.Ip == "" {
+		badRequestError(w, errors.New("email or ip is required"))
+		return
+	}
+
+	if req.Email != "" {
+		c.accountLocks.Reset(accountKey(req.Email))
+	}
+	if req.Ip != "" {
+		c.ipLocks.Reset(req.Ip)
+	}
+	log.Printf("Unlocked login attempts for email %q, ip %q\n", req.Email, req.Ip)
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+// loginAttempt is a password or code check reserved with the account and
+// client trackers. Handlers defer release, which ends the attempt unless
+// it already failed or succeeded.
+type loginAttempt struct {
+	c        ApiConfig
+	account  string
+	ip       string
+	finished bool
+}
+
+// checkLoginAttempts reserves an attempt for the account and the client,
+// or responds with 429 when either has to wait. Accounts are keyed by the
+// address typed in, so unknown addresses are throttled exactly like real
+// ones.
+func (c ApiConfig) checkLoginAttempts(w http.ResponseWriter, r *http.Request, email string) (*loginAttempt, bool) {
+	now := time.Now()
+	attempt := &loginAttempt{c: c, account: accountKey(email), ip: clientIp(r)}
+	accountWait, accountOk := c.accountLocks.Begin(attempt.account, now)
+	ipWait, ipOk := c.ipLocks.Begin(attempt.ip, now)
+	if accountOk && ipOk {
+		return attempt, true
+	}
+	if accountOk {
+		c.accountLocks.Done(attempt.account)
+	}
+	if ipOk {
+		c.ipLocks.Done(attempt.ip)
+	}
+	tooManyRequestsError(w, max(accountWait, ipWait))
+	return nil, false
+}
+
+func (a *loginAttempt) fail() {
+	if a.finished {
+		return
+	}
+	a.finished = true
+	now := time.Now()
+	a.c.accountLocks.Fail(a.account, now)
+	a.c.ipLocks.Fail(a.ip, now)
+}
+
+// succeed is called once a login has fully succeeded, including its second
+// factor. The client address is not reset, so an attacker cannot clear it
+// by logging into an account of their own.
+func (a *loginAttempt) succeed() {
+	if a.finished {
+		return
+	}
+	a.finished = true
+	a.c.accountLocks.Done(a.account)
+	a.c.accountLocks.Reset(a.account)
+	a.c.ipLocks.Done(a.ip)
+}
+
+// release ends an attempt that neither failed nor completed a login, such
+// as a correct password that still needs its second factor.
+func (a *loginAttempt) release() {
+	if a.finished {
+		return
+	}
+	a.finished = true
+	a.c.accountLocks.Done(a.account)
+	a.c.ipLocks.Done(a.ip)
+}
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
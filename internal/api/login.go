@@ -1,11 +1,16 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/like2foxes/chirpy/internal/database"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -15,24 +20,102 @@ func (c *ApiConfig) PostLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	attempt, ok := c.checkLoginAttempts(w, r, u.Email)
+	if !ok {
+		return
+	}
+	defer attempt.release()
+
 	user, err := c.db.GetUserByEmail(u.Email)
-	if err != nil {
+	if err != nil && err.Error() != "not found" {
 		queryError(w, err)
 		return
 	}
+	// Unknown addresses get the same answer, after the same bcrypt work, as
+	// wrong passwords, so logins do not reveal who has an account.
+	hash := c.dummyHash
+	if err == nil {
+		hash = user.Password
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(u.Password)) != nil || err != nil {
+		attempt.fail()
+		autherizationHeaderError(w, errors.New("invalid email or password"))
+		return
+	}
+	if c.db.PasswordNeedsRehash(user.Password) {
+		user = c.rehashPassword(user, u.Password)
+	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(u.Password)) != nil {
-		autherizationHeaderError(w, errors.New("invalid password"))
+	if user.TwoFactor != nil && user.TwoFactor.Enabled {
+		c.respondWithTwoFactorChallenge(w, user)
 		return
 	}
+	attempt.succeed()
+	c.issueLoginTokens(w, r, user)
+}
+
+// checkCurrentPassword asks a signed-in user for their password before a
+// sensitive change, so a stolen access token alone is not enough. Wrong
+// passwords count as failed logins. On success the reserved attempt is
+// returned, and the caller must end it.
+func (c ApiConfig) checkCurrentPassword(w http.ResponseWriter, r *http.Request, user database.User, password string) (*loginAttempt, bool) {
+	attempt, ok := c.checkLoginAttempts(w, r, user.Email)
+	if !ok {
+		return nil, false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		attempt.fail()
+		autherizationHeaderError(w, errors.New("invalid password"))
+		return nil, false
+	}
+	return attempt, true
+}
+
+// rehashPassword stores the password again with the configured bcrypt
+// cost. The plain password is only available at login, so that is when old
+// hashes are upgraded. A failure is logged and the login goes on.
+func (c ApiConfig) rehashPassword(user database.User, plain string) database.User {
+	user.Password = plain
+	updated, err := c.db.UpdateUser(user)
+	if err != nil {
+		log.Printf("Error rehashing password of user %d: %s\n", user.Id, err.Error())
+		return user
+	}
+	return updated
+}
 
-	accessToken, err := c.createJWTTokenForUser(user.Id, time.Now().Add(time.Hour), "chirpy-access")
+// issueLoginTokens starts a session for the user and responds with its
+// access and refresh tokens.
+func (c ApiConfig) issueLoginTokens(w http.ResponseWriter, r *http.Request, user database.User) {
+	refreshToken, record, err := c.newRefreshToken(user.Id)
 	if err != nil {
 		internalServerError(w, err)
 		return
 	}
-
-	refreshToken, err := c.createJWTTokenForUser(user.Id, time.Now().Add(time.Hour*24*60), "chirpy-refresh")
+	record.FamilyId, err = newTokenId()
+	if err != nil {
+		internalServerError(w, err)
+		return
+	}
+	_, err = c.db.CreateRefreshToken(record)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	_, err = c.db.CreateSession(database.Session{
+		UserId:         user.Id,
+		FamilyId:       record.FamilyId,
+		RefreshTokenId: record.Id,
+		UserAgent:      r.UserAgent(),
+		Ip:             clientIp(r),
+	})
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	// The access token names the session by its family, so it stops
+	// working as soon as the session is revoked.
+	accessToken, err := c.createJWTTokenForUser(user.Id, time.Now().Add(time.Hour), issuerAccess, record.FamilyId)
 	if err != nil {
 		internalServerError(w, err)
 		return
@@ -48,58 +131,70 @@ func (c *ApiConfig) PostLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c ApiConfig) PostRefresh(w http.ResponseWriter, r *http.Request) {
-	claims, ok := parseClaimsFromHeader(w, r, c.jwtSecret)
-	if !ok {
-		return
-	}
-	if claims.Issuer != "chirpy-refresh" {
-		tokenParsingError(w, errors.New("invalid token issuer"))
-		return
-	}
-
-	token, ok := getTokenStringFromHeader(w, r)
-	if !ok {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok || principal.TokenId == "" {
 		tokenParsingError(w, errors.New("invalid token"))
 		return
 	}
+	id := principal.UserId
 
-	if c.db.IsTokenRevoked(token) {
-		tokenParsingError(w, errors.New("token is revoked"))
+	refreshToken, record, err := c.newRefreshToken(id)
+	if err != nil {
+		internalServerError(w, err)
 		return
 	}
-
-	id, err := strconv.Atoi(claims.Subject)
+	record, err = c.db.RotateRefreshToken(principal.TokenId, record)
 	if err != nil {
-		tokenParsingError(w, errors.New("invalid token"))
+		switch err.Error() {
+		case "not found", "token is revoked", "token reuse detected":
+			tokenParsingError(w, err)
+		default:
+			queryError(w, err)
+		}
+		return
+	}
+	err = c.db.TouchSession(record.FamilyId, record.Id)
+	if err != nil && err.Error() != "not found" {
+		queryError(w, err)
 		return
 	}
 
-	token, err = c.createJWTTokenForUser(id, time.Now().Add(time.Hour), "chirpy-access")
+	token, err := c.createJWTTokenForUser(id, time.Now().Add(time.Hour), issuerAccess, record.FamilyId)
 	if err != nil {
 		internalServerError(w, err)
 		return
 	}
 
 	tokenResponse := TokenResponse{
-		Token: token,
+		Token:        token,
+		RefreshToken: refreshToken,
 	}
 
 	respondWithJSON(w, http.StatusOK, tokenResponse)
 }
 
 func (c ApiConfig) PostRevoke(w http.ResponseWriter, r *http.Request) {
-	token, ok := getTokenStringFromHeader(w, r)
+	principal, ok := PrincipalFromContext(r.Context())
 	if !ok {
 		tokenParsingError(w, errors.New("invalid token"))
 		return
 	}
 
-	err := c.db.RevokeToken(token)
+	err := c.db.RevokeToken(principal.Token)
 	if err != nil {
 		internalServerError(w, err)
 		return
 	}
 
+	// Revoking a refresh token logs out its whole family.
+	if principal.TokenId != "" {
+		err = c.db.RevokeRefreshTokenFamily(principal.TokenId)
+		if err != nil && err.Error() != "not found" {
+			queryError(w, err)
+			return
+		}
+	}
+
 	respondWithJSON(w, http.StatusOK, nil)
 }
 
@@ -111,5 +206,44 @@ type postLoginResponse struct {
 }
 
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+const refreshTokenLifetime = time.Hour * 24 * 60
+
+// newRefreshToken signs a refresh token with a fresh JWT id and returns it
+// with the record to store for it. The caller decides whether the record
+// starts a new family or rotates an existing token.
+func (c ApiConfig) newRefreshToken(userId int) (string, database.RefreshToken, error) {
+	tokenId, err := newTokenId()
+	if err != nil {
+		return "", database.RefreshToken{}, err
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(refreshTokenLifetime)
+	token, err := c.signClaims(jwt.RegisteredClaims{
+		ID:        tokenId,
+		Issuer:    issuerRefresh,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		Subject:   strconv.Itoa(userId),
+	})
+	if err != nil {
+		return "", database.RefreshToken{}, err
+	}
+	return token, database.RefreshToken{
+		Id:        tokenId,
+		UserId:    userId,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func newTokenId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/like2foxes/chirpy/internal/database"
+	"github.com/like2foxes/chirpy/internal/media"
+)
+
+const (
+	maxMediaSize     = 5 << 20
+	maxMediaPerChirp = 4
+)
+
+// maxMediaWorkers bounds how many uploads are processed at the same time.
+const maxMediaWorkers = 4
+
+var mediaExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+}
+
+type mediaResponse struct {
+	database.Media
+	Url string `json:"url"`
+}
+
+func (c ApiConfig) PostMedia(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize+1<<20)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		badRequestError(w, errors.New("missing file"))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxMediaSize+1))
+	if err != nil {
+		decodingError(w, err)
+		return
+	}
+	if len(data) > maxMediaSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "file is too large")
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := mediaExtensions[contentType]
+	if !ok {
+		respondWithError(w, http.StatusUnsupportedMediaType, "unsupported media type")
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	media, created, err := c.db.CreateMedia(database.Media{
+		OwnerId:     userId,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Sha256:      hash,
+		FileName:    hash + ext,
+	})
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	// Repeated uploads share the record, and its processing job, of the
+	// first one.
+	if created {
+		c.queueMedia(media, data)
+	}
+	respondWithJSON(w, http.StatusAccepted, newMediaResponse(media))
+}
+
+func (c ApiConfig) GetMediaInfo(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	media, _, err := c.db.GetVisibleMedia(id, viewerIdFromRequest(r))
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newMediaResponse(media))
+}
+
+// GetMedia serves the file of media the viewer may see. Only media that
+// anonymous viewers can see may be kept by shared caches; other media is
+// revalidated on every use, so losing access takes effect.
+func (c ApiConfig) GetMedia(w http.ResponseWriter, r *http.Request) {
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	media, public, err := c.db.GetVisibleMedia(id, viewerIdFromRequest(r))
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+
+	if media.Status != database.MediaStatusReady {
+		respondWithError(w, http.StatusConflict, "media is "+media.Status)
+		return
+	}
+
+	fileName := media.FileName
+	etag := `"` + media.Sha256 + `"`
+	if r.URL.Query().Get("variant") == "thumbnail" {
+		fileName = media.ThumbnailFileName
+		etag = `"` + media.Sha256 + `-thumbnail"`
+	}
+	if public {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.mediaRoot, fileName))
+	if err != nil {
+		internalServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// queueMedia keeps the upload in the pending directory until it has been
+// processed, so ResumeMedia can pick it up again after a restart.
+func (c ApiConfig) queueMedia(m database.Media, data []byte) {
+	err := os.MkdirAll(c.pendingMediaDir(), 0755)
+	if err == nil {
+		err = os.WriteFile(c.pendingMediaPath(m), data, 0644)
+	}
+	if err != nil {
+		log.Printf("Error saving pending media %d: %s\n", m.Id, err.Error())
+	}
+	go c.processMedia(m, data)
+}
+
+// ResumeMedia processes the uploads that were still pending when the
+// server stopped. Uploads whose data was lost are marked as failed.
+func (c ApiConfig) ResumeMedia() {
+	pending, err := c.db.GetPendingMedia()
+	if err != nil {
+		log.Printf("Error loading pending media: %s\n", err.Error())
+		return
+	}
+	for _, m := range pending {
+		data, err := os.ReadFile(c.pendingMediaPath(m))
+		if err != nil {
+			log.Printf("Error resuming media %d: %s\n", m.Id, err.Error())
+			m.Status = database.MediaStatusFailed
+			_, err = c.db.UpdateMedia(m)
+			if err != nil {
+				log.Printf("Error updating media %d: %s\n", m.Id, err.Error())
+			}
+			continue
+		}
+		go c.processMedia(m, data)
+	}
+}
+
+// processMedia strips metadata from the upload, writes it together with its
+// thumbnail and records the result on the media object.
+func (c ApiConfig) processMedia(m database.Media, data []byte) {
+	c.mediaWorkers <- struct{}{}
+	defer func() { <-c.mediaWorkers }()
+
+	result, err := media.Process(data, m.ContentType)
+	if err == nil {
+		err = c.writeMediaFile(m.FileName, result.Original)
+	}
+	if err == nil {
+		m.ThumbnailFileName = m.Sha256 + "-thumbnail.png"
+		err = c.writeMediaFile(m.ThumbnailFileName, result.Thumbnail)
+	}
+	if err != nil {
+		log.Printf("Error processing media %d: %s\n", m.Id, err.Error())
+		m.Status = database.MediaStatusFailed
+	} else {
+		m.Status = database.MediaStatusReady
+		m.Width = result.Width
+		m.Height = result.Height
+		m.Blurhash = result.Blurhash
+	}
+
+	_, err = c.db.UpdateMedia(m)
+	if err != nil {
+		log.Printf("Error updating media %d: %s\n", m.Id, err.Error())
+		return
+	}
+	err = os.Remove(c.pendingMediaPath(m))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error removing pending media %d: %s\n", m.Id, err.Error())
+	}
+}
+
+func (c ApiConfig) pendingMediaDir() string {
+	return filepath.Join(c.mediaRoot, "pending")
+}
+
+// pendingMediaPath is keyed by id, since uploads of the same content by
+// different users are processed separately.
+func (c ApiConfig) pendingMediaPath(m database.Media) string {
+	return filepath.Join(c.pendingMediaDir(), strconv.Itoa(m.Id))
+}
+
+// writeMediaFile stores the file under its content hash, so identical
+// uploads share a single file on disk.
+func (c ApiConfig) writeMediaFile(fileName string, data []byte) error {
+	path := filepath.Join(c.mediaRoot, fileName)
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	err := os.MkdirAll(c.mediaRoot, 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func newMediaResponse(media database.Media) mediaResponse {
+	return mediaResponse{
+		Media: media,
+		Url:   fmt.Sprintf("/api/media/%d", media.Id),
+	}
+}
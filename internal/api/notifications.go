@@ -0,0 +1,109 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"github.com/like2foxes/chirpy/internal/database"
+	"github.com/like2foxes/chirpy/internal/events"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_])@([A-Za-z0-9_]{3,30})`)
+
+type markReadRequest struct {
+	Ids []int `json:"ids"`
+}
+
+type markReadResponse struct {
+	Marked int `json:"marked"`
+}
+
+func (c ApiConfig) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, ok := paginationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	notifications, err := c.db.GetNotifications(userId, unreadOnly)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, paginate(notifications, limit, offset))
+}
+
+// PostNotificationsRead marks the notifications listed in ids as read, or
+// every notification when ids is empty.
+func (c ApiConfig) PostNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var req markReadRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	marked, err := c.db.MarkNotificationsRead(userId, req.Ids)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, markReadResponse{Marked: marked})
+}
+
+// notifyOnEvent turns domain events into notifications for the users they
+// concern.
+func (c ApiConfig) notifyOnEvent(event events.Event) {
+	switch event.Type {
+	case events.ChirpCreated:
+		chirp := event.Chirp
+		notified := []int{}
+		if chirp.ReplyToId != nil {
+			parent, err := c.db.GetChirp(*chirp.ReplyToId)
+			if err == nil {
+				c.notify(parent.AuthorId, database.NotificationReply, event.ActorId, &chirp.Id)
+				notified = append(notified, parent.AuthorId)
+			}
+		}
+		for _, match := range mentionPattern.FindAllStringSubmatch(chirp.Body, -1) {
+			mentioned, err := c.db.GetUserByHandle(match[1])
+			if err != nil || slices.Contains(notified, mentioned.Id) {
+				continue
+			}
+			c.notify(mentioned.Id, database.NotificationMention, event.ActorId, &chirp.Id)
+			notified = append(notified, mentioned.Id)
+		}
+	case events.UserFollowed:
+		c.notify(event.TargetUserId, database.NotificationFollow, event.ActorId, nil)
+	case events.ReactionAdded:
+		c.notify(event.Chirp.AuthorId, database.NotificationReaction, event.ActorId, &event.Chirp.Id)
+	case events.ChirpDeleted:
+		err := c.db.DeleteNotificationsForChirp(event.Chirp.Id)
+		if err != nil {
+			log.Printf("Error deleting notifications for chirp %d: %s\n", event.Chirp.Id, err.Error())
+		}
+	}
+}
+
+func (c ApiConfig) notify(userId int, notificationType string, actorId int, chirpId *int) {
+	notification, created, err := c.db.CreateNotification(userId, notificationType, actorId, chirpId)
+	if err != nil {
+		log.Printf("Error creating %s notification for user %d: %s\n", notificationType, userId, err.Error())
+		return
+	}
+	if created {
+		c.events.Publish(events.Event{
+			Type:         events.NotificationCreated,
+			ActorId:      actorId,
+			Notification: &notification,
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/like2foxes/chirpy/internal/database"
+	chirpymail "github.com/like2foxes/chirpy/internal/mail"
+)
+
+const passwordResetLifetime = time.Hour
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// PostPasswordForgot mails a password reset token. It answers the same way
+// whether or not the address belongs to an account, so it cannot be used
+// to find out who is registered.
+func (c ApiConfig) PostPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	user, err := c.db.GetUserByEmail(req.Email)
+	if err != nil && err.Error() != "not found" {
+		queryError(w, err)
+		return
+	}
+	if err == nil {
+		c.sendPasswordResetEmail(user)
+	}
+	respondWithJSON(w, http.StatusAccepted, nil)
+}
+
+// PostPasswordReset sets a new password with a reset token, logs the user
+// out of every session and deletes their API keys.
+func (c ApiConfig) PostPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	// The password is checked before the token is consumed, so a rejected
+	// password does not use up the email.
+	tokenHash := hashToken(req.Token)
+	token, err := c.db.GetUserToken(database.TokenPurposeResetPassword, tokenHash)
+	if err != nil && err.Error() == "invalid token" {
+		badRequestError(w, err)
+		return
+	}
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	err = c.passwordPolicy.Validate(req.Password, token.Email)
+	if err != nil {
+		badRequestError(w, err)
+		return
+	}
+	token, err = c.db.ConsumeUserToken(database.TokenPurposeResetPassword, tokenHash)
+	if err != nil && err.Error() == "invalid token" {
+		badRequestError(w, err)
+		return
+	}
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	user, err := c.db.GetUser(token.UserId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	if user.Email != token.Email {
+		badRequestError(w, errors.New("invalid token"))
+		return
+	}
+
+	user.Password = req.Password
+	// The token was mailed to the address, which proves the user owns it.
+	user.Verified = true
+	user, err = c.db.UpdateUser(user)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	err = c.db.RevokeUserCredentials(user.Id)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newNoPasswordUser(user))
+}
+
+// sendPasswordResetEmail works like sendVerificationEmail: failures are
+// only logged, since the caller must not reveal whether the user exists.
+func (c ApiConfig) sendPasswordResetEmail(user database.User) {
+	token, err := newTokenId()
+	if err != nil {
+		log.Printf("Error creating password reset token: %s\n", err.Error())
+		return
+	}
+	_, err = c.db.CreateUserToken(database.UserToken{
+		Purpose:   database.TokenPurposeResetPassword,
+		TokenHash: hashToken(token),
+		UserId:    user.Id,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(passwordResetLifetime),
+	})
+	if err != nil {
+		log.Printf("Error storing password reset token: %s\n", err.Error())
+		return
+	}
+
+	go c.sendMail(chirpymail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: "Someone asked to reset the password of your Chirpy account.\n\n" +
+			"To choose a new password, send this token to POST /api/password/reset:\n\n" +
+			token + "\n\n" +
+			"The token expires in one hour. If you did not ask for a reset, you can ignore this email.\n",
+	})
+}
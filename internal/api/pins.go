@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/like2foxes/chirpy/internal/database"
+)
+
+type pinsRequest struct {
+	ChirpIds []int `json:"chirp_ids"`
+}
+
+type pinsResponse struct {
+	ChirpIds []int `json:"chirp_ids"`
+}
+
+// PutPins replaces the authenticated user's pinned chirps.
+func (c ApiConfig) PutPins(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var req pinsRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+	if len(req.ChirpIds) > database.MaxPinnedChirps {
+		badRequestError(w, fmt.Errorf("at most %d chirps can be pinned", database.MaxPinnedChirps))
+		return
+	}
+
+	pinned, err := c.db.SetPinnedChirps(userId, req.ChirpIds)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pinsResponse{ChirpIds: pinned})
+}
+
+func (c ApiConfig) DeletePins(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	pinned, err := c.db.SetPinnedChirps(userId, nil)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pinsResponse{ChirpIds: pinned})
+}
+
+func (c ApiConfig) DeletePin(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	chirpId, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := c.db.GetUser(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	if !slices.Contains(user.PinnedChirpIds, chirpId) {
+		queryError(w, errors.New("not found"))
+		return
+	}
+	remaining := slices.DeleteFunc(user.PinnedChirpIds, func(id int) bool {
+		return id == chirpId
+	})
+	pinned, err := c.db.SetPinnedChirps(userId, remaining)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pinsResponse{ChirpIds: pinned})
+}
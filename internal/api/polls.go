@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/like2foxes/chirpy/internal/database"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 50
+	minPollDuration     = 5 * time.Minute
+	maxPollDuration     = 7 * 24 * time.Hour
+)
+
+type pollRequest struct {
+	Options          []string `json:"options"`
+	Multiple         bool     `json:"multiple"`
+	ExpiresInSeconds int      `json:"expires_in_seconds"`
+}
+
+type voteRequest struct {
+	Choices []int `json:"choices"`
+}
+
+func (p pollRequest) toPoll() (database.Poll, error) {
+	if len(p.Options) < minPollOptions || len(p.Options) > maxPollOptions {
+		return database.Poll{}, fmt.Errorf("a poll needs %d to %d options", minPollOptions, maxPollOptions)
+	}
+	options := []string{}
+	for _, option := range p.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || len(option) > maxPollOptionLength {
+			return database.Poll{}, errors.New("invalid poll option")
+		}
+		options = append(options, cleanData(option))
+	}
+	duration := time.Duration(p.ExpiresInSeconds) * time.Second
+	if duration < minPollDuration || duration > maxPollDuration {
+		return database.Poll{}, fmt.Errorf("a poll must run between %s and %s", minPollDuration, maxPollDuration)
+	}
+	return database.Poll{
+		Options:   options,
+		Multiple:  p.Multiple,
+		ExpiresAt: time.Now().UTC().Add(duration),
+	}, nil
+}
+
+func (c ApiConfig) GetPoll(w http.ResponseWriter, r *http.Request) {
+	viewerId := viewerIdFromRequest(r)
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := c.db.GetPollResults(id, viewerId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, results)
+}
+
+func (c ApiConfig) PostPollVote(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	var req voteRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	results, err := c.db.VoteInPoll(id, userId, req.Choices)
+	if err != nil {
+		switch err.Error() {
+		case "already voted":
+			conflictError(w, err)
+		case "poll is closed", "invalid choices":
+			badRequestError(w, err)
+		default:
+			queryError(w, err)
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, results)
+}
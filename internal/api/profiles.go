@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/like2foxes/chirpy/internal/database"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// publicUser is the only shape in which other users are exposed. It never
+// carries the email or the password hash.
+type publicUser struct {
+	Id int `json:"id"`
+	database.Profile
+	AvatarUrl string `json:"avatar_url,omitempty"`
+}
+
+type publicProfile struct {
+	publicUser
+	PinnedChirps []database.Chirp `json:"pinned_chirps"`
+}
+
+func newPublicUser(u database.User) publicUser {
+	public := publicUser{
+		Id:      u.Id,
+		Profile: u.Profile,
+	}
+	if u.AvatarMediaId != nil {
+		public.AvatarUrl = fmt.Sprintf("/api/media/%d?variant=thumbnail", *u.AvatarMediaId)
+	}
+	return public
+}
+
+// apply validates the update and returns the user with it applied.
+func (u userUpdate) apply(user database.User) (database.User, error) {
+	if u.Email != "" && u.Email != user.Email {
+		err := validateEmail(u.Email)
+		if err != nil {
+			return database.User{}, err
+		}
+		user.Email = u.Email
+		user.Verified = false
+	}
+	user.Password = u.Password
+
+	if u.Handle != nil {
+		handle := strings.TrimPrefix(strings.TrimSpace(*u.Handle), "@")
+		if handle != "" && !handlePattern.MatchString(handle) {
+			return database.User{}, errors.New("handle must be 3-30 letters, digits or underscores")
+		}
+		user.Handle = handle
+	}
+	if u.DisplayName != nil {
+		displayName := strings.TrimSpace(*u.DisplayName)
+		if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			return database.User{}, fmt.Errorf("display name is longer than %d characters", maxDisplayNameLength)
+		}
+		user.DisplayName = displayName
+	}
+	if u.Bio != nil {
+		bio := strings.TrimSpace(*u.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			return database.User{}, fmt.Errorf("bio is longer than %d characters", maxBioLength)
+		}
+		user.Bio = cleanData(bio)
+	}
+	if u.AvatarMediaId != nil {
+		if *u.AvatarMediaId == 0 {
+			user.AvatarMediaId = nil
+		} else {
+			user.AvatarMediaId = u.AvatarMediaId
+		}
+	}
+	return user, nil
+}
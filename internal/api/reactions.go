@@ -0,0 +1,193 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/like2foxes/chirpy/internal/events"
+)
+
+const maxEmojiLength = 64
+
+const (
+	zeroWidthJoiner   = 0x200D
+	variationSelector = 0xFE0F
+	combiningKeycap   = 0x20E3
+	tagCancel         = 0xE007F
+)
+
+// emojiBaseRanges is a conservative approximation of the Unicode
+// Emoji_Presentation and Extended_Pictographic properties.
+var emojiBaseRanges = [][2]rune{
+	{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x21AA}, {0x231A, 0x23FF},
+	{0x24C2, 0x24C2}, {0x25AA, 0x27BF}, {0x2934, 0x2935}, {0x2B05, 0x2B55},
+	{0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3297}, {0x3299, 0x3299},
+	{0x1F000, 0x1F1E5}, {0x1F200, 0x1F3FA}, {0x1F400, 0x1FAFF},
+}
+
+func (c ApiConfig) PostReaction(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	chirpId, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	emoji, ok := emojiFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	chirp, err := c.db.AddReaction(chirpId, userId, emoji)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	c.events.Publish(events.Event{
+		Type:    events.ReactionAdded,
+		ActorId: userId,
+		Chirp:   &chirp,
+		Emoji:   emoji,
+	})
+	c.events.Publish(events.Event{
+		Type:    events.ChirpUpdated,
+		ActorId: userId,
+		Chirp:   &chirp,
+	})
+	respondWithJSON(w, http.StatusOK, chirp)
+}
+
+func (c ApiConfig) DeleteReaction(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	chirpId, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	emoji, ok := emojiFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	chirp, err := c.db.RemoveReaction(chirpId, userId, emoji)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	c.events.Publish(events.Event{
+		Type:    events.ChirpUpdated,
+		ActorId: userId,
+		Chirp:   &chirp,
+	})
+	respondWithJSON(w, http.StatusOK, chirp)
+}
+
+func (c ApiConfig) GetUserReactions(w http.ResponseWriter, r *http.Request) {
+	viewerId := viewerIdFromRequest(r)
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, ok := paginationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	reactions, err := c.db.GetUserReactions(id, viewerId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, paginate(reactions, limit, offset))
+}
+
+func emojiFromURL(w http.ResponseWriter, r *http.Request) (string, bool) {
+	emoji, err := url.PathUnescape(chi.URLParam(r, "emoji"))
+	if err != nil {
+		badRequestError(w, errors.New("invalid emoji"))
+		return "", false
+	}
+	if len(emoji) > maxEmojiLength || !isSingleEmoji(emoji) {
+		badRequestError(w, errors.New("reaction must be a single emoji"))
+		return "", false
+	}
+	return emoji, true
+}
+
+// isSingleEmoji reports whether s is exactly one emoji grapheme cluster: a
+// flag, a keycap, or emoji joined by zero width joiners, each optionally
+// followed by a variation selector, a skin tone modifier or a tag sequence.
+func isSingleEmoji(s string) bool {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return false
+	}
+	if len(runes) == 2 && isRegionalIndicator(runes[0]) && isRegionalIndicator(runes[1]) {
+		return true
+	}
+	if isKeycapBase(runes[0]) {
+		rest := runes[1:]
+		if len(rest) > 0 && rest[0] == variationSelector {
+			rest = rest[1:]
+		}
+		return len(rest) == 1 && rest[0] == combiningKeycap
+	}
+
+	i := 0
+	for {
+		if i >= len(runes) || !isEmojiBase(runes[i]) {
+			return false
+		}
+		i++
+		if i < len(runes) && (runes[i] == variationSelector || isSkinToneModifier(runes[i])) {
+			i++
+		}
+		if i < len(runes) && isTag(runes[i]) {
+			for i < len(runes) && isTag(runes[i]) {
+				i++
+			}
+			if i >= len(runes) || runes[i] != tagCancel {
+				return false
+			}
+			i++
+		}
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner {
+			return false
+		}
+		i++
+	}
+}
+
+func isEmojiBase(r rune) bool {
+	for _, rng := range emojiBaseRanges {
+		if r >= rng[0] && r <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isSkinToneModifier(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+func isKeycapBase(r rune) bool {
+	return (r >= '0' && r <= '9') || r == '#' || r == '*'
+}
+
+func isTag(r rune) bool {
+	return r >= 0xE0020 && r <= 0xE007E
+}
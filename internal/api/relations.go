@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/like2foxes/chirpy/internal/events"
+)
+
+func (c ApiConfig) PostBlock(w http.ResponseWriter, r *http.Request) {
+	c.updateRelation(w, r, c.db.BlockUser)
+}
+
+func (c ApiConfig) DeleteBlock(w http.ResponseWriter, r *http.Request) {
+	c.updateRelation(w, r, c.db.UnblockUser)
+}
+
+func (c ApiConfig) PostMute(w http.ResponseWriter, r *http.Request) {
+	c.updateRelation(w, r, c.db.MuteUser)
+}
+
+func (c ApiConfig) DeleteMute(w http.ResponseWriter, r *http.Request) {
+	c.updateRelation(w, r, c.db.UnmuteUser)
+}
+
+func (c ApiConfig) PostFollow(w http.ResponseWriter, r *http.Request) {
+	userId, targetId, ok := c.updateRelation(w, r, c.db.FollowUser)
+	if !ok {
+		return
+	}
+	c.events.Publish(events.Event{
+		Type:         events.UserFollowed,
+		ActorId:      userId,
+		TargetUserId: targetId,
+	})
+}
+
+func (c ApiConfig) DeleteFollow(w http.ResponseWriter, r *http.Request) {
+	c.updateRelation(w, r, c.db.UnfollowUser)
+}
+
+// updateRelation applies update between the authenticated user and the
+// user in the URL, and returns both ids once the response has been sent.
+func (c ApiConfig) updateRelation(
+	w http.ResponseWriter,
+	r *http.Request,
+	update func(userId int, targetId int) error,
+) (int, int, bool) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+	targetId, ok := idFromURL(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+	if userId == targetId {
+		badRequestError(w, errors.New("cannot target yourself"))
+		return 0, 0, false
+	}
+
+	err := update(userId, targetId)
+	if err != nil && err.Error() == "user is blocked" {
+		forbiddenError(w, err)
+		return 0, 0, false
+	}
+	if err != nil {
+		queryError(w, err)
+		return 0, 0, false
+	}
+	respondWithJSON(w, http.StatusOK, nil)
+	return userId, targetId, true
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/like2foxes/chirpy/internal/database"
+)
+
+type sessionResponse struct {
+	Id         int       `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+type revokedSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+func (c ApiConfig) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := c.db.GetSessions(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	response := []sessionResponse{}
+	for _, session := range sessions {
+		response = append(response, newSessionResponse(session))
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (c ApiConfig) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	id, ok := idFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := c.db.RevokeSession(id, userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+// DeleteSessions logs the user out on every device and deletes their API
+// keys.
+func (c ApiConfig) DeleteSessions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := c.db.RevokeAllSessions(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, revokedSessionsResponse{Revoked: revoked})
+}
+
+func newSessionResponse(session database.Session) sessionResponse {
+	return sessionResponse{
+		Id:         session.Id,
+		UserAgent:  session.UserAgent,
+		Ip:         session.Ip,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+	}
+}
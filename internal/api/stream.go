@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/like2foxes/chirpy/internal/database"
+	"github.com/like2foxes/chirpy/internal/events"
+	"github.com/like2foxes/chirpy/internal/stream"
+)
+
+const (
+	streamHistorySize = 1000
+	heartbeatInterval = 15 * time.Second
+	// hiddenAuthorsRefresh is how long a connection keeps using the blocks
+	// and mutes it loaded before reading them again.
+	hiddenAuthorsRefresh = time.Minute
+)
+
+var hashtagPattern = regexp.MustCompile(`#([A-Za-z0-9_]+)`)
+
+type streamFilter struct {
+	viewerId int
+	authorId int
+	hashtag  string
+	// hidden caches the authors the viewer blocked, muted or was blocked
+	// by, so events do not each load them from the database.
+	hidden         map[int]bool
+	hiddenLoadedAt time.Time
+}
+
+// GetStream is a Server-Sent Events feed of created, updated and deleted
+// chirps. It accepts optional author_id and hashtag filters and resumes
+// after the Last-Event-ID header when the event is still buffered. New
+// connections without the header only get live events.
+func (c ApiConfig) GetStream(w http.ResponseWriter, r *http.Request) {
+	viewerId := viewerIdFromRequest(r)
+	filter := &streamFilter{
+		viewerId: viewerId,
+		hashtag:  strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("hashtag"), "#")),
+	}
+	if author := r.URL.Query().Get("author_id"); author != "" {
+		var ok bool
+		filter.authorId, ok = intFromQuery(w, author)
+		if !ok {
+			return
+		}
+	}
+	var lastId uint64
+	last := r.Header.Get("Last-Event-ID")
+	if last != "" {
+		parsed, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			badRequestError(w, errors.New("invalid Last-Event-ID"))
+			return
+		}
+		lastId = parsed
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		internalServerError(w, errors.New("streaming is not supported"))
+		return
+	}
+
+	var replay []stream.Message
+	var messages <-chan stream.Message
+	var cancel func()
+	if last != "" {
+		replay, messages, cancel = c.stream.Resume(lastId)
+	} else {
+		messages, cancel = c.stream.Subscribe()
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for _, msg := range replay {
+		if !c.writeStreamMessage(w, msg, filter) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			if !c.writeStreamMessage(w, msg, filter) {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeStreamMessage writes msg if it passes the filter and reports whether
+// the connection is still usable.
+func (c ApiConfig) writeStreamMessage(w http.ResponseWriter, msg stream.Message, filter *streamFilter) bool {
+	if !c.streamFilterMatches(msg, filter) {
+		return true
+	}
+	data, err := json.Marshal(msg.Chirp)
+	if err != nil {
+		log.Printf("Error encoding stream message: %s\n", err.Error())
+		return true
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.Id, msg.Event, data)
+	return err == nil
+}
+
+func (c ApiConfig) streamFilterMatches(msg stream.Message, filter *streamFilter) bool {
+	if filter.authorId != 0 && msg.Chirp.AuthorId != filter.authorId {
+		return false
+	}
+	if filter.hashtag != "" && !hasHashtag(msg.Chirp.Body, filter.hashtag) {
+		return false
+	}
+	if msg.Chirp.AuthorId == filter.viewerId {
+		return true
+	}
+	if filter.viewerId != 0 {
+		hidden, err := c.hiddenAuthors(filter)
+		if err != nil || hidden[msg.Chirp.AuthorId] {
+			return false
+		}
+	}
+	// Blocks are covered by the hidden authors, so public chirps need no
+	// further lookup.
+	switch msg.Chirp.Visibility {
+	case database.VisibilityPublic, "":
+		return true
+	}
+	visible, err := c.db.CanViewChirp(msg.Chirp, filter.viewerId)
+	return err == nil && visible
+}
+
+func (c ApiConfig) hiddenAuthors(filter *streamFilter) (map[int]bool, error) {
+	if filter.hidden != nil && time.Since(filter.hiddenLoadedAt) < hiddenAuthorsRefresh {
+		return filter.hidden, nil
+	}
+	hidden, err := c.db.GetHiddenAuthorIds(filter.viewerId)
+	if err != nil {
+		return nil, err
+	}
+	filter.hidden = hidden
+	filter.hiddenLoadedAt = time.Now()
+	return hidden, nil
+}
+
+// streamOnEvent forwards chirp events to the stream broker.
+func (c ApiConfig) streamOnEvent(event events.Event) {
+	switch event.Type {
+	case events.ChirpCreated, events.ChirpUpdated, events.ChirpDeleted:
+		c.stream.Publish(string(event.Type), *event.Chirp)
+	}
+}
+
+func hasHashtag(body string, hashtag string) bool {
+	for _, match := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		if strings.ToLower(match[1]) == hashtag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/like2foxes/chirpy/internal/database"
+	"github.com/like2foxes/chirpy/internal/totp"
+)
+
+const (
+	totpIssuer                 = "Chirpy"
+	recoveryCodeCount          = 10
+	twoFactorChallengeLifetime = 5 * time.Minute
+)
+
+type twoFactorEnrollment struct {
+	Secret        string   `json:"secret"`
+	OtpauthUri    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// twoFactorCode carries either a code from the authenticator app or one of
+// the recovery codes.
+type twoFactorCode struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// startTwoFactorRequest carries the current password, so a stolen access
+// token alone cannot enroll an authenticator the owner does not have.
+type startTwoFactorRequest struct {
+	Password string `json:"password"`
+}
+
+// disableTwoFactorRequest needs the current password as well as a code,
+// so neither a stolen access token nor a stolen phone turns 2FA off.
+type disableTwoFactorRequest struct {
+	twoFactorCode
+	Password string `json:"password"`
+}
+
+type twoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+// PostTwoFactor starts enrolling the user in two-factor authentication. It
+// is not enforced until PostTwoFactorConfirm accepts a code, so a user who
+// never finishes setting up their app is not locked out. The recovery
+// codes are only ever shown in this response. It takes the current
+// password, and wrong passwords count as failed logins.
+func (c ApiConfig) PostTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var req startTwoFactorRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+	user, err := c.db.GetUser(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	attempt, ok := c.checkCurrentPassword(w, r, user, req.Password)
+	if !ok {
+		return
+	}
+	defer attempt.release()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		internalServerError(w, err)
+		return
+	}
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			internalServerError(w, err)
+			return
+		}
+		hashes[i] = hashToken(codes[i])
+	}
+
+	err = c.db.StartTwoFactor(userId, secret, hashes)
+	if err != nil && err.Error() == "two-factor authentication is already enabled" {
+		conflictError(w, err)
+		return
+	}
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, twoFactorEnrollment{
+		Secret:        secret,
+		OtpauthUri:    totp.URI(totpIssuer, user.Email, secret),
+		RecoveryCodes: codes,
+	})
+}
+
+// PostTwoFactorConfirm enables two-factor authentication once the user
+// proves their app produces valid codes.
+func (c ApiConfig) PostTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var req twoFactorCode
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	user, err := c.db.GetUser(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	if user.TwoFactor == nil {
+		queryError(w, errors.New("not found"))
+		return
+	}
+	if user.TwoFactor.Enabled {
+		conflictError(w, errors.New("two-factor authentication is already enabled"))
+		return
+	}
+	// Codes are throttled like at login, or the pending secret could be
+	// guessed with a stolen access token.
+	attempt, ok := c.checkLoginAttempts(w, r, user.Email)
+	if !ok {
+		return
+	}
+	defer attempt.release()
+	// Recovery codes cannot confirm an enrollment; they do not show the
+	// app was set up.
+	err = c.verifyTwoFactorCode(user, twoFactorCode{Code: req.Code}, http.StatusBadRequest)
+	var reqErr requestError
+	if errors.As(err, &reqErr) {
+		attempt.fail()
+	}
+	if err != nil {
+		requestOrQueryError(w, err)
+		return
+	}
+
+	user, err = c.db.GetUser(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newNoPasswordUser(user))
+}
+
+// DeleteTwoFactor turns two-factor authentication off. It takes the
+// current password and a current code, both throttled like a login, so a
+// stolen access token alone cannot disable it.
+func (c ApiConfig) DeleteTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, ok := userIdFromRequest(w, r)
+	if !ok {
+		return
+	}
+	var req disableTwoFactorRequest
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	user, err := c.db.GetUser(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	attempt, ok := c.checkCurrentPassword(w, r, user, req.Password)
+	if !ok {
+		return
+	}
+	defer attempt.release()
+	if user.TwoFactor != nil && user.TwoFactor.Enabled {
+		err = c.verifyTwoFactorCode(user, req.twoFactorCode, http.StatusBadRequest)
+		var reqErr requestError
+		if errors.As(err, &reqErr) {
+			attempt.fail()
+		}
+		if err != nil {
+			requestOrQueryError(w, err)
+			return
+		}
+	}
+	err = c.db.DisableTwoFactor(userId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, nil)
+}
+
+// PostLoginTwoFactor is the second step of a two-factor login. It takes
+// the challenge token from PostLogin and a code, and issues the session
+// tokens. Each challenge token works once.
+func (c ApiConfig) PostLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		tokenParsingError(w, errors.New("invalid token"))
+		return
+	}
+	var req twoFactorCode
+	if !decodeItemOr404(w, r, &req) {
+		return
+	}
+
+	user, err := c.db.GetUser(principal.UserId)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	if user.TwoFactor == nil || !user.TwoFactor.Enabled {
+		tokenParsingError(w, errors.New("two-factor authentication is not enabled"))
+		return
+	}
+	// Codes are throttled like passwords; a challenge token lasts long
+	// enough to try many of them.
+	attempt, ok := c.checkLoginAttempts(w, r, user.Email)
+	if !ok {
+		return
+	}
+	defer attempt.release()
+	err = c.verifyTwoFactorCode(user, req, http.StatusUnauthorized)
+	var reqErr requestError
+	if errors.As(err, &reqErr) {
+		attempt.fail()
+	}
+	if err != nil {
+		requestOrQueryError(w, err)
+		return
+	}
+
+	err = c.db.RevokeToken(principal.Token)
+	if err != nil {
+		internalServerError(w, err)
+		return
+	}
+	attempt.succeed()
+	c.issueLoginTokens(w, r, user)
+}
+
+func (c ApiConfig) respondWithTwoFactorChallenge(w http.ResponseWriter, user database.User) {
+	// The id keeps challenge tokens issued within the same second distinct,
+	// since a used challenge is revoked by its token string.
+	tokenId, err := newTokenId()
+	if err != nil {
+		internalServerError(w, err)
+		return
+	}
+	now := time.Now().UTC()
+	token, err := c.signClaims(jwt.RegisteredClaims{
+		ID:        tokenId,
+		Issuer:    issuerChallenge,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorChallengeLifetime)),
+		Subject:   strconv.Itoa(user.Id),
+	})
+	if err != nil {
+		internalServerError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, twoFactorChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+	})
+}
+
+// verifyTwoFactorCode checks a code against the user's enrollment and
+// marks it used. Rejected codes are reported with the given status.
+func (c ApiConfig) verifyTwoFactorCode(user database.User, req twoFactorCode, status int) error {
+	invalid := requestError{status, "invalid code"}
+
+	if req.Code != "" {
+		step, ok := totp.Validate(user.TwoFactor.Secret, req.Code, time.Now())
+		if !ok {
+			return invalid
+		}
+		err := c.db.UseTwoFactorStep(user.Id, step)
+		if err != nil && err.Error() == "code was already used" {
+			return invalid
+		}
+		return err
+	}
+	if req.RecoveryCode != "" {
+		err := c.db.UseRecoveryCode(user.Id, hashToken(normalizeRecoveryCode(req.RecoveryCode)))
+		if err != nil && err.Error() == "invalid code" {
+			return invalid
+		}
+		return err
+	}
+	return requestError{http.StatusBadRequest, "code is required"}
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCode returns a random 50 bit code formatted as xxxxx-xxxxx.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) == 10 && !strings.Contains(code, "-") {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
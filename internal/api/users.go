@@ -1,13 +1,12 @@
 package api
 
 import (
-	"errors"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/like2foxes/chirpy/internal/database"
 )
@@ -19,52 +18,72 @@ type user struct {
 }
 
 type noPasswordUser struct {
-	Id    int    `json:"id"`
-	Email string `json:"email"`
+	Id               int    `json:"id"`
+	Email            string `json:"email"`
+	IsVerified       bool   `json:"is_verified"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	database.Profile
+}
+
+// userUpdate is the body of PutUser. Omitted fields keep their current
+// value. Changing the email or password requires the current password.
+type userUpdate struct {
+	Email           string  `json:"email"`
+	Password        string  `json:"password"`
+	CurrentPassword string  `json:"current_password"`
+	Handle          *string `json:"handle"`
+	DisplayName     *string `json:"display_name"`
+	Bio             *string `json:"bio"`
+	AvatarMediaId   *int    `json:"avatar_media_id"`
 }
 
 func (c ApiConfig) PutUser(w http.ResponseWriter, r *http.Request) {
-	claims, ok := parseClaimsFromHeader(w, r, c.jwtSecret)
+	id, ok := userIdFromRequest(w, r)
 	if !ok {
 		return
 	}
 
-	log.Printf("claims: %+v\n", claims)
-	if !isIssuerIsAccess(claims) {
-		tokenParsingError(w, errors.New("invalid token issuer"))
-		return
-	}
-
-	if !validateExpirationTime(w, r, claims) {
-		return
-	}
-
-	var u user
+	var u userUpdate
 	if !decodeItemOr404(w, r, &u) {
 		return
 	}
 
-	id, err := strconv.Atoi(claims.Subject)
+	user, err := c.db.GetUser(id)
 	if err != nil {
-		tokenParsingError(w, err)
+		queryError(w, err)
 		return
 	}
-
-	user, err := c.db.GetUser(id)
+	updatedUser, err := u.apply(user)
 	if err != nil {
-		queryError(w, err)
+		badRequestError(w, err)
 		return
 	}
-	updatedUser := database.User{
-		Id:       user.Id,
-		Email:    u.Email,
-		Password: u.Password,
+	if u.Password != "" {
+		err = c.passwordPolicy.Validate(u.Password, updatedUser.Email)
+		if err != nil {
+			badRequestError(w, err)
+			return
+		}
+	}
+	if updatedUser.Email != user.Email || u.Password != "" {
+		attempt, ok := c.checkCurrentPassword(w, r, user, u.CurrentPassword)
+		if !ok {
+			return
+		}
+		defer attempt.release()
 	}
 	response, err := c.db.UpdateUser(updatedUser)
+	if err != nil && (err.Error() == "handle is taken" || err.Error() == "email is taken") {
+		conflictError(w, err)
+		return
+	}
 	if err != nil {
 		queryError(w, err)
 		return
 	}
+	if response.Email != user.Email {
+		c.sendVerificationEmail(response)
+	}
 	noPWUser := newNoPasswordUser(response)
 	respondWithJSON(w, http.StatusOK, noPWUser)
 }
@@ -75,11 +94,27 @@ func (c ApiConfig) PostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err := validateEmail(u.Email)
+	if err != nil {
+		badRequestError(w, err)
+		return
+	}
+	err = c.passwordPolicy.Validate(u.Password, u.Email)
+	if err != nil {
+		badRequestError(w, err)
+		return
+	}
+
 	user, err := c.db.CreateUser(u.Email, u.Password)
+	if err != nil && err.Error() == "a user with that email already exists" {
+		conflictError(w, err)
+		return
+	}
 	if err != nil {
 		queryError(w, err)
 		return
 	}
+	c.sendVerificationEmail(user)
 	noPWUser := newNoPasswordUser(user)
 
 	respondWithJSON(w, http.StatusCreated, noPWUser)
@@ -91,10 +126,15 @@ func (c ApiConfig) GetUsers(w http.ResponseWriter, r *http.Request) {
 		queryError(w, err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, users)
+	publicUsers := []publicUser{}
+	for _, user := range users {
+		publicUsers = append(publicUsers, newPublicUser(user))
+	}
+	respondWithJSON(w, http.StatusOK, publicUsers)
 }
 
 func (c ApiConfig) GetUser(w http.ResponseWriter, r *http.Request) {
+	viewerId := viewerIdFromRequest(r)
 	id, ok := idFromURL(w, r)
 	if !ok {
 		return
@@ -104,99 +144,60 @@ func (c ApiConfig) GetUser(w http.ResponseWriter, r *http.Request) {
 		queryError(w, err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, user)
+	c.respondWithProfile(w, user, viewerId)
 }
 
-func newNoPasswordUser(u database.User) noPasswordUser {
-	return noPasswordUser{
-		Id:    u.Id,
-		Email: u.Email,
+func (c ApiConfig) GetUserByHandle(w http.ResponseWriter, r *http.Request) {
+	viewerId := viewerIdFromRequest(r)
+	user, err := c.db.GetUserByHandle(chi.URLParam(r, "handle"))
+	if err != nil {
+		queryError(w, err)
+		return
 	}
+	c.respondWithProfile(w, user, viewerId)
 }
 
-func (c ApiConfig) createJWTTokenForUser(id int, exTime time.Time, issuer string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{})
-	claims := jwt.RegisteredClaims{
-		Issuer:   issuer,
-		IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(exTime),
-		Subject: strconv.Itoa(id),
-	}
-	token.Claims = claims
-	tokenString, err := token.SignedString([]byte(c.jwtSecret))
+func (c ApiConfig) respondWithProfile(w http.ResponseWriter, user database.User, viewerId int) {
+	pinned, err := c.db.GetPinnedChirps(user.Id, viewerId)
 	if err != nil {
-		log.Println(err.Error())
-		log.Println("Error signing token")
-		return "", err
+		queryError(w, err)
+		return
 	}
-	return tokenString, nil
+	respondWithJSON(w, http.StatusOK, publicProfile{
+		publicUser:   newPublicUser(user),
+		PinnedChirps: pinned,
+	})
 }
 
-func parseClaimsFromHeader(w http.ResponseWriter, r *http.Request, secret string) (jwt.RegisteredClaims, bool) {
-	tokenString, ok := getTokenStringFromHeader(w, r)
-	if !ok {
-		return jwt.RegisteredClaims{}, false
-	}
-	claimes, ok := parseTokenString(w, tokenString, secret)
-	if !ok {
-		return jwt.RegisteredClaims{}, false
+func newNoPasswordUser(u database.User) noPasswordUser {
+	return noPasswordUser{
+		Id:               u.Id,
+		Email:            u.Email,
+		IsVerified:       u.Verified,
+		TwoFactorEnabled: u.TwoFactor != nil && u.TwoFactor.Enabled,
+		Profile:          u.Profile,
 	}
-	return *claimes, true
 }
 
-func parseTokenString(
-	w http.ResponseWriter,
-	tokenString string,
-	secret string,
-) (*jwt.RegisteredClaims, bool) {
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&jwt.RegisteredClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
+func (c ApiConfig) createJWTTokenForUser(id int, exTime time.Time, issuer string, sessionId string) (string, error) {
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   issuer,
+			IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(exTime),
+			Subject: strconv.Itoa(id),
 		},
-	)
-	if err != nil {
-		tokenParsingError(w, err)
-		return nil, false
-	}
-
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok {
-		tokenParsingError(w, errors.New("invalid token claims"))
-		return nil, false
-	}
-	return claims, true
-}
-
-func getTokenStringFromHeader(w http.ResponseWriter, r *http.Request) (string, bool) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		autherizationHeaderError(w, errors.New("no authorization header"))
-		return "", false
-	}
-	authHeaderParts := strings.Split(authHeader, " ")
-	if len(authHeaderParts) != 2 {
-		autherizationHeaderError(w, errors.New("invalid authorization header"))
-		return "", false
+		SessionId: sessionId,
 	}
-	tokenString := authHeaderParts[1]
-	return tokenString, true
+	return c.signClaims(claims)
 }
 
-func isIssuerIsAccess(claims jwt.RegisteredClaims) bool {
-	return claims.Issuer == "chirpy-access"
-}
-
-func validateExpirationTime(w http.ResponseWriter, r *http.Request, claims jwt.RegisteredClaims) bool {
-	expiresAt, err := claims.GetExpirationTime()
+func (c ApiConfig) signClaims(claims jwt.Claims) (string, error) {
+	tokenString, err := c.keys.Sign(claims)
 	if err != nil {
-		tokenParsingError(w, err)
-		return false
-	}
-	if jwt.NewNumericDate(time.Now().UTC()).After(expiresAt.Time) {
-		tokenParsingError(w, errors.New("token expired"))
-		return false
+		log.Println(err.Error())
+		log.Println("Error signing token")
+		return "", err
 	}
-	return true
+	return tokenString, nil
 }
@@ -2,7 +2,9 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"slices"
 	"strconv"
@@ -56,8 +58,52 @@ func decodeItemOr404(w http.ResponseWriter, r *http.Request, item interface{}) b
 	return true
 }
 
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// paginationFromURL reads the optional limit and offset query parameters.
+func paginationFromURL(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	limit := defaultPageLimit
+	offset := 0
+	query := r.URL.Query()
+	if l := query.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			paginationError(w, errors.New("invalid limit: "+l))
+			return 0, 0, false
+		}
+		limit = parsed
+	}
+	if o := query.Get("offset"); o != "" {
+		parsed, err := strconv.Atoi(o)
+		if err != nil || parsed < 0 {
+			paginationError(w, errors.New("invalid offset: "+o))
+			return 0, 0, false
+		}
+		offset = parsed
+	}
+	return limit, offset, true
+}
+
+func paginate[T any](items []T, limit int, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
+
 func idFromURL(w http.ResponseWriter, r *http.Request) (int, bool) {
-	id := chi.URLParam(r, "id")
+	return intFromURL(w, r, "id")
+}
+
+func intFromURL(w http.ResponseWriter, r *http.Request, key string) (int, bool) {
+	id := chi.URLParam(r, key)
 	idAsInt, err := strconv.Atoi(id)
 	if err != nil {
 		conversionError(w, err)
@@ -65,3 +111,22 @@ func idFromURL(w http.ResponseWriter, r *http.Request) (int, bool) {
 	}
 	return idAsInt, true
 }
+
+func intFromQuery(w http.ResponseWriter, value string) (int, bool) {
+	valueAsInt, err := strconv.Atoi(value)
+	if err != nil {
+		conversionError(w, err)
+		return 0, false
+	}
+	return valueAsInt, true
+}
+
+// clientIp returns the address of the peer that sent the request. Proxy
+// headers are not trusted since the server does not know its proxies.
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
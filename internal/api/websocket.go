@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/like2foxes/chirpy/internal/events"
+	"github.com/like2foxes/chirpy/internal/stream"
+)
+
+const (
+	wsChannelNotifications = "notifications"
+	wsChannelMessages      = "messages"
+
+	wsClientBuffer  = 64
+	wsReplyBuffer   = 16
+	wsMaxMessage    = 4096
+	wsWriteWait     = 10 * time.Second
+	wsPongWait      = 60 * time.Second
+	wsPingPeriod    = wsPongWait * 9 / 10
+	wsSlowClientMsg = "client is too slow"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Like the REST API, the gateway accepts any origin; it is authorized
+	// by the access token, not by cookies.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type wsClientMessage struct {
+	Type     string   `json:"type"`
+	Channels []string `json:"channels"`
+}
+
+type wsServerMessage struct {
+	Type     string          `json:"type"`
+	Channel  string          `json:"channel,omitempty"`
+	Channels []string        `json:"channels,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// wsSubscriptions is the set of channels a connection listens to. It is
+// written by the read loop and read by the write loop.
+type wsSubscriptions struct {
+	mux      *sync.Mutex
+	channels []string
+}
+
+func (s *wsSubscriptions) update(channels []string, subscribe bool) []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, channel := range channels {
+		i := slices.Index(s.channels, channel)
+		if subscribe && i < 0 {
+			s.channels = append(s.channels, channel)
+		}
+		if !subscribe && i >= 0 {
+			s.channels = slices.Delete(s.channels, i, i+1)
+		}
+	}
+	return slices.Clone(s.channels)
+}
+
+func (s *wsSubscriptions) has(channel string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return slices.Contains(s.channels, channel)
+}
+
+// GetWebSocket upgrades to a WebSocket that delivers the user's
+// notifications and direct messages. Browsers cannot set headers on
+// WebSocket requests, so the access token may also be passed as the
+// access_token query parameter. The connection is closed when the token
+// expires or is revoked, or its session ends.
+func (c ApiConfig) GetWebSocket(w http.ResponseWriter, r *http.Request) {
+	tokenString := r.URL.Query().Get("access_token")
+	if tokenString == "" {
+		var err error
+		tokenString, err = bearerToken(r)
+		if err != nil {
+			autherizationHeaderError(w, err)
+			return
+		}
+	}
+	principal, err := c.authenticate(tokenString, issuerAccess)
+	if err != nil {
+		tokenParsingError(w, err)
+		return
+	}
+	userId := principal.UserId
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error upgrading websocket: %s\n", err.Error())
+		return
+	}
+	client := c.hub.Register(userId)
+	subscriptions := &wsSubscriptions{mux: &sync.Mutex{}}
+	replies := make(chan wsServerMessage, wsReplyBuffer)
+	done := make(chan struct{})
+
+	go c.wsWriteLoop(conn, client, subscriptions, replies, done, tokenString, principal.ExpiresAt)
+	wsReadLoop(conn, subscriptions, replies)
+
+	close(done)
+	c.hub.Unregister(client)
+}
+
+func wsReadLoop(conn *websocket.Conn, subscriptions *wsSubscriptions, replies chan<- wsServerMessage) {
+	conn.SetReadLimit(wsMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var msg wsClientMessage
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Error reading websocket: %s\n", err.Error())
+			}
+			return
+		}
+
+		var reply wsServerMessage
+		switch msg.Type {
+		case "subscribe", "unsubscribe":
+			if !validWsChannels(msg.Channels) {
+				reply = wsServerMessage{Type: "error", Error: "unknown channel"}
+				break
+			}
+			channels := subscriptions.update(msg.Channels, msg.Type == "subscribe")
+			reply = wsServerMessage{Type: "subscriptions", Channels: channels}
+		case "ping":
+			reply = wsServerMessage{Type: "pong"}
+		default:
+			reply = wsServerMessage{Type: "error", Error: "unknown message type"}
+		}
+
+		select {
+		case replies <- reply:
+		default:
+			// The write loop is not keeping up; stop reading from a client
+			// that keeps sending while ignoring our replies.
+			return
+		}
+	}
+}
+
+func (c ApiConfig) wsWriteLoop(
+	conn *websocket.Conn,
+	client *stream.Client,
+	subscriptions *wsSubscriptions,
+	replies <-chan wsServerMessage,
+	done <-chan struct{},
+	tokenString string,
+	expiresAt time.Time,
+) {
+	ping := time.NewTicker(wsPingPeriod)
+	expiry := time.NewTimer(time.Until(expiresAt))
+	defer func() {
+		ping.Stop()
+		expiry.Stop()
+		conn.Close()
+	}()
+
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case envelope, ok := <-client.Send:
+			if !ok {
+				wsClose(conn, websocket.CloseTryAgainLater, wsSlowClientMsg)
+				return
+			}
+			if !subscriptions.has(envelope.Channel) {
+				continue
+			}
+			err = wsWrite(conn, wsServerMessage{Type: "event", Channel: envelope.Channel, Data: envelope.Data})
+		case reply := <-replies:
+			err = wsWrite(conn, reply)
+		case <-expiry.C:
+			wsClose(conn, websocket.ClosePolicyViolation, "token expired")
+			return
+		case <-ping.C:
+			// Checking the token again like a new request catches revoked
+			// tokens as well as sessions that were ended since.
+			if _, err := c.authenticate(tokenString, issuerAccess); err != nil {
+				wsClose(conn, websocket.ClosePolicyViolation, "token revoked")
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			err = conn.WriteMessage(websocket.PingMessage, nil)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wsOnEvent routes notifications and direct messages to the connections of
+// the users they are for.
+func (c ApiConfig) wsOnEvent(event events.Event) {
+	switch event.Type {
+	case events.NotificationCreated:
+		c.wsSend(event.Notification.UserId, wsChannelNotifications, event.Notification)
+	case events.MessageCreated:
+		for _, recipientId := range event.RecipientIds {
+			c.wsSend(recipientId, wsChannelMessages, event.Message)
+		}
+	}
+}
+
+func (c ApiConfig) wsSend(userId int, channel string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding websocket payload: %s\n", err.Error())
+		return
+	}
+	c.hub.SendTo(userId, stream.Envelope{Channel: channel, Data: data})
+}
+
+func wsWrite(conn *websocket.Conn, msg wsServerMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(msg)
+}
+
+func wsClose(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(wsWriteWait),
+	)
+}
+
+func validWsChannels(channels []string) bool {
+	if len(channels) == 0 {
+		return false
+	}
+	for _, channel := range channels {
+		if channel != wsChannelNotifications && channel != wsChannelMessages {
+			return false
+		}
+	}
+	return true
+}
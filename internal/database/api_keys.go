@@ -0,0 +1,125 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// lastUsedResolution limits how often using a key rewrites the database.
+const lastUsedResolution = time.Minute
+
+// ApiKey is a long-lived credential a user creates for a bot or an
+// integration. Only a hash of the key is stored; Prefix is kept so users
+// can tell their keys apart.
+type ApiKey struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"key_hash"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func (k ApiKey) GetId() int {
+	return k.Id
+}
+
+func (db *DB) CreateApiKey(key ApiKey) (ApiKey, error) {
+	err := db.update(func(dbStruct *DBStructure) error {
+		if !userExists(dbStruct.Users, key.UserId) {
+			return errors.New("not found")
+		}
+		key.Id = nextId(dbStruct, "api_keys", dbStruct.ApiKeys)
+		key.CreatedAt = time.Now().UTC()
+		dbStruct.ApiKeys = append(dbStruct.ApiKeys, key)
+		return nil
+	})
+	if err != nil {
+		return ApiKey{}, err
+	}
+	return key, nil
+}
+
+func (db *DB) GetApiKeys(userId int) ([]ApiKey, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	keys := []ApiKey{}
+	for _, key := range dbStruct.ApiKeys {
+		if key.UserId == userId {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// DeleteApiKey revokes one of the user's keys. Keys of other users are
+// reported as not found.
+func (db *DB) DeleteApiKey(id int, userId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		for i, key := range dbStruct.ApiKeys {
+			if key.Id == id && key.UserId == userId {
+				dbStruct.ApiKeys = append(dbStruct.ApiKeys[:i], dbStruct.ApiKeys[i+1:]...)
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+}
+
+// UseApiKey returns the key with the given hash and records that it was
+// used. The database is only written when the recorded time is older than
+// lastUsedResolution, and then under the write lock so concurrent changes
+// are not overwritten.
+func (db *DB) UseApiKey(keyHash string) (ApiKey, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return ApiKey{}, err
+	}
+	key, ok := findApiKey(dbStruct.ApiKeys, keyHash)
+	if !ok {
+		return ApiKey{}, errors.New("not found")
+	}
+	now := time.Now().UTC()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < lastUsedResolution {
+		return key, nil
+	}
+
+	err = db.update(func(dbStruct *DBStructure) error {
+		for i := range dbStruct.ApiKeys {
+			if dbStruct.ApiKeys[i].KeyHash == keyHash {
+				dbStruct.ApiKeys[i].LastUsedAt = &now
+				key = dbStruct.ApiKeys[i]
+				return nil
+			}
+		}
+		// The key was deleted since it was loaded.
+		return errors.New("not found")
+	})
+	if err != nil {
+		return ApiKey{}, err
+	}
+	return key, nil
+}
+
+func findApiKey(keys []ApiKey, keyHash string) (ApiKey, bool) {
+	for _, key := range keys {
+		if key.KeyHash == keyHash {
+			return key, true
+		}
+	}
+	return ApiKey{}, false
+}
+
+func deleteUserApiKeys(dbStruct *DBStructure, userId int) {
+	kept := []ApiKey{}
+	for _, key := range dbStruct.ApiKeys {
+		if key.UserId != userId {
+			kept = append(kept, key)
+		}
+	}
+	dbStruct.ApiKeys = kept
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+type Bookmark struct {
+	UserId    int       `json:"user_id"`
+	ChirpId   int       `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) CreateBookmark(userId int, chirpId int) (Bookmark, error) {
+	var bookmark Bookmark
+	err := db.update(func(dbStruct *DBStructure) error {
+		chirp, ok := findChirp(dbStruct.Chirps, chirpId)
+		if !ok || !canView(*dbStruct, chirp, userId) {
+			return errors.New("not found")
+		}
+		for _, existing := range dbStruct.Bookmarks {
+			if existing.UserId == userId && existing.ChirpId == chirpId {
+				bookmark = existing
+				return nil
+			}
+		}
+
+		bookmark = Bookmark{
+			UserId:    userId,
+			ChirpId:   chirpId,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStruct.Bookmarks = append(dbStruct.Bookmarks, bookmark)
+		return nil
+	})
+	if err != nil {
+		return Bookmark{}, err
+	}
+	return bookmark, nil
+}
+
+func (db *DB) DeleteBookmark(userId int, chirpId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		for i, bookmark := range dbStruct.Bookmarks {
+			if bookmark.UserId == userId && bookmark.ChirpId == chirpId {
+				dbStruct.Bookmarks = append(dbStruct.Bookmarks[:i], dbStruct.Bookmarks[i+1:]...)
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+}
+
+// GetBookmarkedChirps returns the chirps bookmarked by the user, newest
+// bookmark first.
+func (db *DB) GetBookmarkedChirps(userId int) ([]Chirp, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var bookmarks []Bookmark
+	for _, bookmark := range dbStruct.Bookmarks {
+		if bookmark.UserId == userId {
+			bookmarks = append(bookmarks, bookmark)
+		}
+	}
+	sort.SliceStable(bookmarks, func(i, j int) bool {
+		return bookmarks[i].CreatedAt.After(bookmarks[j].CreatedAt)
+	})
+
+	chirps := []Chirp{}
+	for _, bookmark := range bookmarks {
+		chirp, ok := findChirp(dbStruct.Chirps, bookmark.ChirpId)
+		if ok && canView(dbStruct, chirp, userId) {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps, nil
+}
+
+func removeBookmarksForChirp(bookmarks []Bookmark, chirpId int) []Bookmark {
+	kept := []Bookmark{}
+	for _, bookmark := range bookmarks {
+		if bookmark.ChirpId != chirpId {
+			kept = append(kept, bookmark)
+		}
+	}
+	return kept
+}
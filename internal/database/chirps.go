@@ -5,29 +5,48 @@ import (
 )
 
 type Chirp struct {
-	Id       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorId int    `json:"author_id"`
+	Id           int            `json:"id"`
+	Body         string         `json:"body"`
+	AuthorId     int            `json:"author_id"`
+	ReplyToId    *int           `json:"reply_to_id,omitempty"`
+	Visibility   string         `json:"visibility"`
+	RecipientIds []int          `json:"recipient_ids,omitempty"`
+	MediaIds     []int          `json:"media_ids,omitempty"`
+	Poll         *Poll          `json:"poll,omitempty"`
+	Reactions    map[string]int `json:"reactions,omitempty"`
 }
 
 func (c Chirp) GetId() int {
 	return c.Id
 }
 
-func (db *DB) CreateChirp(body string, authorId int) (Chirp, error) {
-	dbStruct, err := db.loadDB()
-	if err != nil {
-		return Chirp{}, err
+func (db *DB) CreateChirp(chirp Chirp) (Chirp, error) {
+	if chirp.Visibility == "" {
+		chirp.Visibility = VisibilityPublic
 	}
-
-	id := calculateId(dbStruct.Chirps)
-	chirp := Chirp{
-		Id:   id,
-		Body: body,
-		AuthorId: authorId,
+	if !IsValidVisibility(chirp.Visibility) {
+		return Chirp{}, errors.New("invalid visibility")
 	}
-	dbStruct.Chirps = append(dbStruct.Chirps, chirp)
-	err = db.writeDb(dbStruct)
+	err := db.update(func(dbStruct *DBStructure) error {
+		if chirp.ReplyToId != nil && !chirpExists(dbStruct.Chirps, *chirp.ReplyToId) {
+			return errors.New("not found")
+		}
+		for _, recipientId := range chirp.RecipientIds {
+			if !userExists(dbStruct.Users, recipientId) {
+				return errors.New("not found")
+			}
+		}
+		for _, mediaId := range chirp.MediaIds {
+			media, ok := findMedia(dbStruct.Media, mediaId)
+			if !ok || media.OwnerId != chirp.AuthorId {
+				return errors.New("not found")
+			}
+		}
+
+		chirp.Id = nextId(dbStruct, "chirps", dbStruct.Chirps)
+		dbStruct.Chirps = append(dbStruct.Chirps, chirp)
+		return nil
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
@@ -55,3 +74,41 @@ func (db *DB) GetChirp(id int) (Chirp, error) {
 	}
 	return Chirp{}, errors.New("not found")
 }
+
+func (db *DB) DeleteChirp(id int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		for i, chirp := range dbStruct.Chirps {
+			if chirp.Id == id {
+				dbStruct.Chirps = append(dbStruct.Chirps[:i], dbStruct.Chirps[i+1:]...)
+				unpinChirp(dbStruct.Users, chirp.AuthorId, id)
+				dbStruct.Bookmarks = removeBookmarksForChirp(dbStruct.Bookmarks, id)
+				dbStruct.PollVotes = removePollVotesForChirp(dbStruct.PollVotes, id)
+				dbStruct.Reactions = removeReactionsForChirp(dbStruct.Reactions, id)
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+}
+
+func chirpExists(chirps []Chirp, id int) bool {
+	_, ok := findChirp(chirps, id)
+	return ok
+}
+
+func findChirp(chirps []Chirp, id int) (Chirp, bool) {
+	i, ok := findChirpIndex(chirps, id)
+	if !ok {
+		return Chirp{}, false
+	}
+	return chirps[i], true
+}
+
+func findChirpIndex(chirps []Chirp, id int) (int, bool) {
+	for i, chirp := range chirps {
+		if chirp.Id == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,252 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+type Conversation struct {
+	Id           int           `json:"id"`
+	Participants []Participant `json:"participants"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// Participant tracks a member of a conversation and how far they have read.
+type Participant struct {
+	UserId            int        `json:"user_id"`
+	LastReadMessageId int        `json:"last_read_message_id"`
+	LastReadAt        *time.Time `json:"last_read_at,omitempty"`
+}
+
+type Message struct {
+	Id             int       `json:"id"`
+	ConversationId int       `json:"conversation_id"`
+	SenderId       int       `json:"sender_id"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type ConversationSummary struct {
+	Conversation
+	UnreadCount int `json:"unread_count"`
+}
+
+func (c Conversation) GetId() int {
+	return c.Id
+}
+
+func (m Message) GetId() int {
+	return m.Id
+}
+
+func (c Conversation) hasParticipant(userId int) bool {
+	for _, participant := range c.Participants {
+		if participant.UserId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateConversation starts a conversation between the creator and the given
+// users. Blocked users cannot be added.
+func (db *DB) CreateConversation(creatorId int, userIds []int) (Conversation, error) {
+	var conversation Conversation
+	err := db.update(func(dbStruct *DBStructure) error {
+		memberIds := []int{creatorId}
+		for _, userId := range userIds {
+			if slices.Contains(memberIds, userId) {
+				continue
+			}
+			if !userExists(dbStruct.Users, userId) {
+				return errors.New("not found")
+			}
+			if isBlockedBetween(*dbStruct, creatorId, userId) {
+				return errors.New("user is blocked")
+			}
+			memberIds = append(memberIds, userId)
+		}
+		if len(memberIds) < 2 {
+			return errors.New("a conversation needs at least two participants")
+		}
+
+		now := time.Now().UTC()
+		conversation = Conversation{
+			Id:        nextId(dbStruct, "conversations", dbStruct.Conversations),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		for _, memberId := range memberIds {
+			conversation.Participants = append(conversation.Participants, Participant{UserId: memberId})
+		}
+		dbStruct.Conversations = append(dbStruct.Conversations, conversation)
+		return nil
+	})
+	if err != nil {
+		return Conversation{}, err
+	}
+	return conversation, nil
+}
+
+// GetConversations returns the user's conversations, most recently active
+// first, with the number of messages the user has not read yet.
+func (db *DB) GetConversations(userId int) ([]ConversationSummary, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	summaries := []ConversationSummary{}
+	for _, conversation := range dbStruct.Conversations {
+		if conversation.hasParticipant(userId) {
+			summaries = append(summaries, ConversationSummary{
+				Conversation: conversation,
+				UnreadCount:  unreadCount(dbStruct.Messages, conversation, userId),
+			})
+		}
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+	return summaries, nil
+}
+
+func (db *DB) GetConversation(id int, userId int) (ConversationSummary, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return ConversationSummary{}, err
+	}
+	i, ok := findConversation(dbStruct.Conversations, id, userId)
+	if !ok {
+		return ConversationSummary{}, errors.New("not found")
+	}
+	conversation := dbStruct.Conversations[i]
+	return ConversationSummary{
+		Conversation: conversation,
+		UnreadCount:  unreadCount(dbStruct.Messages, conversation, userId),
+	}, nil
+}
+
+// CreateMessage adds a message to the conversation. It fails if a block
+// separates the sender from any other participant, including blocks made
+// after the conversation started.
+func (db *DB) CreateMessage(conversationId int, senderId int, body string) (Message, error) {
+	var message Message
+	err := db.update(func(dbStruct *DBStructure) error {
+		i, ok := findConversation(dbStruct.Conversations, conversationId, senderId)
+		if !ok {
+			return errors.New("not found")
+		}
+		for _, participant := range dbStruct.Conversations[i].Participants {
+			if participant.UserId != senderId && isBlockedBetween(*dbStruct, senderId, participant.UserId) {
+				return errors.New("user is blocked")
+			}
+		}
+
+		message = Message{
+			Id:             nextId(dbStruct, "messages", dbStruct.Messages),
+			ConversationId: conversationId,
+			SenderId:       senderId,
+			Body:           body,
+			CreatedAt:      time.Now().UTC(),
+		}
+		dbStruct.Messages = append(dbStruct.Messages, message)
+		conversation := &dbStruct.Conversations[i]
+		conversation.UpdatedAt = message.CreatedAt
+		for j := range conversation.Participants {
+			if conversation.Participants[j].UserId == senderId {
+				conversation.Participants[j].LastReadMessageId = message.Id
+				conversation.Participants[j].LastReadAt = &message.CreatedAt
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	return message, nil
+}
+
+// GetMessages returns the messages of a conversation, newest first.
+func (db *DB) GetMessages(conversationId int, userId int) ([]Message, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := findConversation(dbStruct.Conversations, conversationId, userId); !ok {
+		return nil, errors.New("not found")
+	}
+	messages := []Message{}
+	for _, message := range dbStruct.Messages {
+		if message.ConversationId == conversationId {
+			messages = append(messages, message)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Id > messages[j].Id
+	})
+	return messages, nil
+}
+
+// MarkConversationRead records that the user has read every message in the
+// conversation so far.
+func (db *DB) MarkConversationRead(conversationId int, userId int) (Participant, error) {
+	var participant Participant
+	err := db.update(func(dbStruct *DBStructure) error {
+		i, ok := findConversation(dbStruct.Conversations, conversationId, userId)
+		if !ok {
+			return errors.New("not found")
+		}
+
+		lastId := 0
+		for _, message := range dbStruct.Messages {
+			if message.ConversationId == conversationId && message.Id > lastId {
+				lastId = message.Id
+			}
+		}
+		now := time.Now().UTC()
+		participants := dbStruct.Conversations[i].Participants
+		for j := range participants {
+			if participants[j].UserId == userId {
+				participants[j].LastReadMessageId = lastId
+				participants[j].LastReadAt = &now
+				participant = participants[j]
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+	if err != nil {
+		return Participant{}, err
+	}
+	return participant, nil
+}
+
+func findConversation(conversations []Conversation, id int, userId int) (int, bool) {
+	for i, conversation := range conversations {
+		if conversation.Id == id && conversation.hasParticipant(userId) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func unreadCount(messages []Message, conversation Conversation, userId int) int {
+	lastRead := 0
+	for _, participant := range conversation.Participants {
+		if participant.UserId == userId {
+			lastRead = participant.LastReadMessageId
+		}
+	}
+	count := 0
+	for _, message := range messages {
+		if message.ConversationId == conversation.Id &&
+			message.SenderId != userId &&
+			message.Id > lastRead {
+			count++
+		}
+	}
+	return count
+}
@@ -6,28 +6,59 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type DB struct {
-	path string
-	mux  *sync.RWMutex
+	path         string
+	mux          *sync.RWMutex
+	passwordCost int
 }
 
 type DBStructure struct {
-	Chirps  []Chirp              `json:"chirps"`
-	Users   []User               `json:"users"`
-	Revokes map[string]time.Time `json:"revokes"`
+	Chirps        []Chirp              `json:"chirps"`
+	Users         []User               `json:"users"`
+	Revokes       map[string]time.Time `json:"revokes"`
+	Bookmarks     []Bookmark           `json:"bookmarks"`
+	Blocks        []UserRelation       `json:"blocks"`
+	Mutes         []UserRelation       `json:"mutes"`
+	Follows       []UserRelation       `json:"follows"`
+	Conversations []Conversation       `json:"conversations"`
+	Messages      []Message            `json:"messages"`
+	Media         []Media              `json:"media"`
+	PollVotes     []PollVote           `json:"poll_votes"`
+	Drafts        []Draft              `json:"drafts"`
+	Lists         []List               `json:"lists"`
+	Reactions     []Reaction           `json:"reactions"`
+	Notifications []Notification       `json:"notifications"`
+	RefreshTokens []RefreshToken       `json:"refresh_tokens"`
+	Sessions      []Session            `json:"sessions"`
+	UserTokens    []UserToken          `json:"user_tokens"`
+	ApiKeys       []ApiKey             `json:"api_keys"`
+	// LastIds holds the highest id handed out per collection, so ids of
+	// deleted items are never reused.
+	LastIds map[string]int `json:"last_ids"`
 }
 
 func NewDB(path string) (*DB, error) {
 	db := &DB{
-		path: path,
-		mux:  &sync.RWMutex{},
+		path:         path,
+		mux:          &sync.RWMutex{},
+		passwordCost: bcrypt.DefaultCost,
 	}
 	err := db.ensureDb()
 	if err != nil {
 		return nil, err
 	}
+	err = db.verifyLegacyUsers()
+	if err != nil {
+		return nil, err
+	}
+	err = db.initLastIds()
+	if err != nil {
+		return nil, err
+	}
 
 	return db, nil
 }
@@ -40,9 +71,26 @@ func (db *DB) ensureDb() error {
 			return err
 		}
 		dbStruct := DBStructure{
-			Chirps: []Chirp{},
-			Users:  []User{},
-			Revokes: map[string]time.Time{},
+			Chirps:        []Chirp{},
+			Users:         []User{},
+			Revokes:       map[string]time.Time{},
+			Bookmarks:     []Bookmark{},
+			Blocks:        []UserRelation{},
+			Mutes:         []UserRelation{},
+			Follows:       []UserRelation{},
+			Conversations: []Conversation{},
+			Messages:      []Message{},
+			Media:         []Media{},
+			PollVotes:     []PollVote{},
+			Drafts:        []Draft{},
+			Lists:         []List{},
+			Reactions:     []Reaction{},
+			Notifications: []Notification{},
+			RefreshTokens: []RefreshToken{},
+			Sessions:      []Session{},
+			UserTokens:    []UserToken{},
+			ApiKeys:       []ApiKey{},
+			LastIds:       map[string]int{},
 		}
 		content, err := json.Marshal(dbStruct)
 		if err != nil {
@@ -62,9 +110,79 @@ func (db *DB) ensureDb() error {
 	return nil
 }
 
+// verifyLegacyUsers marks users that signed up before email verification
+// existed as verified, so they keep the access they had. Their records have
+// no is_verified field at all, while every user stored since has one, so
+// this changes nothing once it has run.
+func (db *DB) verifyLegacyUsers() error {
+	return db.update(func(dbStruct *DBStructure) error {
+		content, err := os.ReadFile(db.path)
+		if err != nil {
+			return err
+		}
+		var raw struct {
+			Users []map[string]json.RawMessage `json:"users"`
+		}
+		err = json.Unmarshal(content, &raw)
+		if err != nil {
+			return err
+		}
+		for i, user := range raw.Users {
+			if _, ok := user["is_verified"]; !ok {
+				dbStruct.Users[i].Verified = true
+			}
+		}
+		return nil
+	})
+}
+
+// initLastIds starts the id counters of a database written before they
+// existed at the highest id stored in each collection.
+func (db *DB) initLastIds() error {
+	return db.update(func(dbStruct *DBStructure) error {
+		if dbStruct.LastIds != nil {
+			return nil
+		}
+		dbStruct.LastIds = map[string]int{
+			"chirps":        maxId(dbStruct.Chirps),
+			"users":         maxId(dbStruct.Users),
+			"conversations": maxId(dbStruct.Conversations),
+			"messages":      maxId(dbStruct.Messages),
+			"media":         maxId(dbStruct.Media),
+			"drafts":        maxId(dbStruct.Drafts),
+			"lists":         maxId(dbStruct.Lists),
+			"notifications": maxId(dbStruct.Notifications),
+			"sessions":      maxId(dbStruct.Sessions),
+			"api_keys":      maxId(dbStruct.ApiKeys),
+		}
+		return nil
+	})
+}
+
 func (db *DB) loadDB() (DBStructure, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
+	return db.readFile()
+}
+
+// update loads the database, applies fn and writes the result while holding
+// the write lock throughout, so checks made by fn still hold when its
+// changes are written. Nothing is written when fn returns an error.
+func (db *DB) update(fn func(dbStruct *DBStructure) error) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	dbStruct, err := db.readFile()
+	if err != nil {
+		return err
+	}
+	err = fn(&dbStruct)
+	if err != nil {
+		return err
+	}
+	return db.writeFile(dbStruct)
+}
+
+func (db *DB) readFile() (DBStructure, error) {
 	f, err := os.Open(db.path)
 	if err != nil {
 		log.Println("Error opening file")
@@ -83,29 +201,32 @@ func (db *DB) loadDB() (DBStructure, error) {
 	return dbStruct, nil
 }
 
-func (db *DB) writeDb(dbStruct DBStructure) error {
-	db.mux.Lock()
-	defer db.mux.Unlock()
+func (db *DB) writeFile(dbStruct DBStructure) error {
 	updatedDB, err := json.Marshal(dbStruct)
 	if err != nil {
 		log.Println("Error encoding file")
 		return err
 	}
-	os.WriteFile(db.path, updatedDB, 0666)
-	return nil
+	return os.WriteFile(db.path, updatedDB, 0666)
 }
 
-func calculateId[T HasId](data []T) int {
-	if len(data) == 0 {
-		return 1
+// nextId hands out the next id of the collection. Ids only ever grow, so an
+// id stays unique after the item holding it is deleted.
+func nextId[T HasId](dbStruct *DBStructure, collection string, data []T) int {
+	if dbStruct.LastIds == nil {
+		dbStruct.LastIds = map[string]int{}
 	}
-	maxId := 1
+	id := max(dbStruct.LastIds[collection], maxId(data)) + 1
+	dbStruct.LastIds[collection] = id
+	return id
+}
+
+func maxId[T HasId](data []T) int {
+	highest := 0
 	for _, item := range data {
-		if item.GetId() > maxId {
-			maxId = item.GetId()
-		}
+		highest = max(highest, item.GetId())
 	}
-	return maxId + 1
+	return highest
 }
 
 type HasId interface {
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Draft is an unpublished chirp. Drafts with a PublishAt time are scheduled
+// and get published by the scheduler once that time has passed.
+type Draft struct {
+	Id           int        `json:"id"`
+	AuthorId     int        `json:"author_id"`
+	Body         string     `json:"body"`
+	ReplyToId    *int       `json:"reply_to_id,omitempty"`
+	Visibility   string     `json:"visibility,omitempty"`
+	RecipientIds []int      `json:"recipient_ids,omitempty"`
+	MediaIds     []int      `json:"media_ids,omitempty"`
+	Poll         *DraftPoll `json:"poll,omitempty"`
+	PublishAt    *time.Time `json:"publish_at,omitempty"`
+	PublishError string     `json:"publish_error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// DraftPoll keeps the poll duration rather than its expiry, which is only
+// fixed when the draft is published.
+type DraftPoll struct {
+	Options          []string `json:"options"`
+	Multiple         bool     `json:"multiple"`
+	ExpiresInSeconds int      `json:"expires_in_seconds"`
+}
+
+func (d Draft) GetId() int {
+	return d.Id
+}
+
+func (db *DB) CreateDraft(draft Draft) (Draft, error) {
+	err := db.update(func(dbStruct *DBStructure) error {
+		now := time.Now().UTC()
+		draft.Id = nextId(dbStruct, "drafts", dbStruct.Drafts)
+		draft.CreatedAt = now
+		draft.UpdatedAt = now
+		dbStruct.Drafts = append(dbStruct.Drafts, draft)
+		return nil
+	})
+	if err != nil {
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+// GetDrafts returns the author's drafts, most recently edited first.
+func (db *DB) GetDrafts(authorId int) ([]Draft, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	drafts := []Draft{}
+	for _, draft := range dbStruct.Drafts {
+		if draft.AuthorId == authorId {
+			drafts = append(drafts, draft)
+		}
+	}
+	sort.SliceStable(drafts, func(i, j int) bool {
+		return drafts[i].UpdatedAt.After(drafts[j].UpdatedAt)
+	})
+	return drafts, nil
+}
+
+func (db *DB) GetDraft(id int, authorId int) (Draft, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return Draft{}, err
+	}
+	for _, draft := range dbStruct.Drafts {
+		if draft.Id == id && draft.AuthorId == authorId {
+			return draft, nil
+		}
+	}
+	return Draft{}, errors.New("not found")
+}
+
+func (db *DB) UpdateDraft(draft Draft) (Draft, error) {
+	err := db.update(func(dbStruct *DBStructure) error {
+		for i, existing := range dbStruct.Drafts {
+			if existing.Id == draft.Id && existing.AuthorId == draft.AuthorId {
+				draft.CreatedAt = existing.CreatedAt
+				draft.UpdatedAt = time.Now().UTC()
+				dbStruct.Drafts[i] = draft
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+	if err != nil {
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+func (db *DB) DeleteDraft(id int, authorId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		for i, draft := range dbStruct.Drafts {
+			if draft.Id == id && draft.AuthorId == authorId {
+				dbStruct.Drafts = append(dbStruct.Drafts[:i], dbStruct.Drafts[i+1:]...)
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+}
+
+// TakeDraft removes the draft and returns it, so that only one caller can
+// publish it. Callers put it back with RestoreDraft if publishing fails.
+func (db *DB) TakeDraft(id int, authorId int) (Draft, error) {
+	return db.takeDraft(func(draft Draft) bool {
+		return draft.Id == id && draft.AuthorId == authorId
+	})
+}
+
+// TakeDueDraft is TakeDraft for the scheduler. It fails if the draft was
+// published, deleted or rescheduled since it was found to be due.
+func (db *DB) TakeDueDraft(id int, now time.Time) (Draft, error) {
+	return db.takeDraft(func(draft Draft) bool {
+		return draft.Id == id && draft.PublishAt != nil && !draft.PublishAt.After(now)
+	})
+}
+
+func (db *DB) takeDraft(match func(Draft) bool) (Draft, error) {
+	var taken Draft
+	err := db.update(func(dbStruct *DBStructure) error {
+		for i, draft := range dbStruct.Drafts {
+			if match(draft) {
+				taken = draft
+				dbStruct.Drafts = append(dbStruct.Drafts[:i], dbStruct.Drafts[i+1:]...)
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+	if err != nil {
+		return Draft{}, err
+	}
+	return taken, nil
+}
+
+// RestoreDraft puts back a draft removed by TakeDraft. It keeps its id,
+// which no new draft can have taken since ids are never reused.
+func (db *DB) RestoreDraft(draft Draft) (Draft, error) {
+	err := db.update(func(dbStruct *DBStructure) error {
+		dbStruct.Drafts = append(dbStruct.Drafts, draft)
+		return nil
+	})
+	if err != nil {
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+// GetDueDrafts returns every scheduled draft whose publish time is not
+// after now, oldest first.
+func (db *DB) GetDueDrafts(now time.Time) ([]Draft, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	due := []Draft{}
+	for _, draft := range dbStruct.Drafts {
+		if draft.PublishAt != nil && !draft.PublishAt.After(now) {
+			due = append(due, draft)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].PublishAt.Before(*due[j].PublishAt)
+	})
+	return due, nil
+}
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+type List struct {
+	Id        int       `json:"id"`
+	OwnerId   int       `json:"owner_id"`
+	Name      string    `json:"name"`
+	Private   bool      `json:"private"`
+	MemberIds []int     `json:"member_ids"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (l List) GetId() int {
+	return l.Id
+}
+
+func (l List) visibleTo(viewerId int) bool {
+	return !l.Private || l.OwnerId == viewerId
+}
+
+func (db *DB) CreateList(list List) (List, error) {
+	err := db.update(func(dbStruct *DBStructure) error {
+		now := time.Now().UTC()
+		list.Id = nextId(dbStruct, "lists", dbStruct.Lists)
+		list.MemberIds = []int{}
+		list.CreatedAt = now
+		list.UpdatedAt = now
+		dbStruct.Lists = append(dbStruct.Lists, list)
+		return nil
+	})
+	if err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
+
+// GetLists returns the lists owned by ownerId that the viewer can see.
+func (db *DB) GetLists(ownerId int, viewerId int) ([]List, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	lists := []List{}
+	for _, list := range dbStruct.Lists {
+		if list.OwnerId == ownerId && list.visibleTo(viewerId) {
+			lists = append(lists, list)
+		}
+	}
+	return lists, nil
+}
+
+func (db *DB) GetList(id int, viewerId int) (List, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return List{}, err
+	}
+	for _, list := range dbStruct.Lists {
+		if list.Id == id && list.visibleTo(viewerId) {
+			return list, nil
+		}
+	}
+	return List{}, errors.New("not found")
+}
+
+// UpdateList changes the name and privacy of a list owned by ownerId.
+func (db *DB) UpdateList(id int, ownerId int, name string, private bool) (List, error) {
+	return db.mutateList(id, ownerId, func(dbStruct DBStructure, list *List) error {
+		list.Name = name
+		list.Private = private
+		return nil
+	})
+}
+
+func (db *DB) DeleteList(id int, ownerId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		i, err := findOwnedList(dbStruct.Lists, id, ownerId)
+		if err != nil {
+			return err
+		}
+		dbStruct.Lists = append(dbStruct.Lists[:i], dbStruct.Lists[i+1:]...)
+		return nil
+	})
+}
+
+func (db *DB) AddListMember(id int, ownerId int, memberId int) (List, error) {
+	return db.mutateList(id, ownerId, func(dbStruct DBStructure, list *List) error {
+		if !userExists(dbStruct.Users, memberId) {
+			return errors.New("not found")
+		}
+		if isBlockedBetween(dbStruct, ownerId, memberId) {
+			return errors.New("user is blocked")
+		}
+		if !slices.Contains(list.MemberIds, memberId) {
+			list.MemberIds = append(list.MemberIds, memberId)
+		}
+		return nil
+	})
+}
+
+func (db *DB) RemoveListMember(id int, ownerId int, memberId int) (List, error) {
+	return db.mutateList(id, ownerId, func(dbStruct DBStructure, list *List) error {
+		i := slices.Index(list.MemberIds, memberId)
+		if i < 0 {
+			return errors.New("not found")
+		}
+		list.MemberIds = slices.Delete(list.MemberIds, i, i+1)
+		return nil
+	})
+}
+
+// GetListChirps merges the chirps of the list's members that the viewer is
+// allowed to see, newest first.
+func (db *DB) GetListChirps(id int, viewerId int) ([]Chirp, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	for _, list := range dbStruct.Lists {
+		if list.Id != id || !list.visibleTo(viewerId) {
+			continue
+		}
+		chirps := []Chirp{}
+		for _, chirp := range dbStruct.Chirps {
+			if slices.Contains(list.MemberIds, chirp.AuthorId) {
+				chirps = append(chirps, chirp)
+			}
+		}
+		chirps = visibleChirps(dbStruct, chirps, viewerId)
+		sort.SliceStable(chirps, func(i, j int) bool {
+			return chirps[i].Id > chirps[j].Id
+		})
+		return chirps, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (db *DB) mutateList(id int, ownerId int, mutate func(DBStructure, *List) error) (List, error) {
+	var list List
+	err := db.update(func(dbStruct *DBStructure) error {
+		i, err := findOwnedList(dbStruct.Lists, id, ownerId)
+		if err != nil {
+			return err
+		}
+		mutated := &dbStruct.Lists[i]
+		err = mutate(*dbStruct, mutated)
+		if err != nil {
+			return err
+		}
+		mutated.UpdatedAt = time.Now().UTC()
+		list = *mutated
+		return nil
+	})
+	if err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
+
+// findOwnedList reports lists that exist but belong to someone else as
+// forbidden, unless they are private and therefore reported as not found.
+func findOwnedList(lists []List, id int, ownerId int) (int, error) {
+	for i, list := range lists {
+		if list.Id != id {
+			continue
+		}
+		if list.OwnerId == ownerId {
+			return i, nil
+		}
+		if list.Private {
+			return 0, errors.New("not found")
+		}
+		return 0, errors.New("forbidden")
+	}
+	return 0, errors.New("not found")
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+const (
+	MediaStatusPending = "pending"
+	MediaStatusReady   = "ready"
+	MediaStatusFailed  = "failed"
+)
+
+type Media struct {
+	Id                int       `json:"id"`
+	OwnerId           int       `json:"owner_id"`
+	ContentType       string    `json:"content_type"`
+	Size              int64     `json:"size"`
+	Sha256            string    `json:"sha256"`
+	FileName          string    `json:"file_name"`
+	ThumbnailFileName string    `json:"thumbnail_file_name,omitempty"`
+	Status            string    `json:"status"`
+	Width             int       `json:"width,omitempty"`
+	Height            int       `json:"height,omitempty"`
+	Blurhash          string    `json:"blurhash,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+func (m Media) GetId() int {
+	return m.Id
+}
+
+// CreateMedia stores a media record. Uploading the same content twice
+// returns the owner's existing record instead of a new one; created is only
+// true for new records, which still need processing.
+func (db *DB) CreateMedia(media Media) (m Media, created bool, err error) {
+	err = db.update(func(dbStruct *DBStructure) error {
+		for _, existing := range dbStruct.Media {
+			if existing.OwnerId == media.OwnerId && existing.Sha256 == media.Sha256 {
+				media = existing
+				return nil
+			}
+		}
+		media.Id = nextId(dbStruct, "media", dbStruct.Media)
+		media.Status = MediaStatusPending
+		media.CreatedAt = time.Now().UTC()
+		dbStruct.Media = append(dbStruct.Media, media)
+		created = true
+		return nil
+	})
+	if err != nil {
+		return Media{}, false, err
+	}
+	return media, created, nil
+}
+
+// GetVisibleMedia returns the media if the viewer may see it: owners see
+// their uploads, anyone sees avatars, and others see media attached to a
+// chirp they can view. public reports whether anonymous viewers can see it
+// too. Media the viewer may not see is reported as not found.
+func (db *DB) GetVisibleMedia(id int, viewerId int) (media Media, public bool, err error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return Media{}, false, err
+	}
+	media, ok := findMedia(dbStruct.Media, id)
+	if !ok {
+		return Media{}, false, errors.New("not found")
+	}
+
+	for _, user := range dbStruct.Users {
+		if user.AvatarMediaId != nil && *user.AvatarMediaId == id {
+			return media, true, nil
+		}
+	}
+	visible := viewerId != 0 && media.OwnerId == viewerId
+	for _, chirp := range dbStruct.Chirps {
+		if !slices.Contains(chirp.MediaIds, id) {
+			continue
+		}
+		if canView(dbStruct, chirp, 0) {
+			return media, true, nil
+		}
+		if viewerId != 0 && canView(dbStruct, chirp, viewerId) {
+			visible = true
+		}
+	}
+	if !visible {
+		return Media{}, false, errors.New("not found")
+	}
+	return media, false, nil
+}
+
+// GetPendingMedia returns the media whose processing has not finished,
+// such as uploads interrupted by a restart.
+func (db *DB) GetPendingMedia() ([]Media, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	pending := []Media{}
+	for _, m := range dbStruct.Media {
+		if m.Status == MediaStatusPending {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// UpdateMedia replaces the stored record of the media. Processing finishes
+// in the background, so only that record is changed, under the write lock,
+// and everything written meanwhile is kept.
+func (db *DB) UpdateMedia(media Media) (Media, error) {
+	err := db.update(func(dbStruct *DBStructure) error {
+		for i, existing := range dbStruct.Media {
+			if existing.Id == media.Id {
+				dbStruct.Media[i] = media
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+	if err != nil {
+		return Media{}, err
+	}
+	return media, nil
+}
+
+func findMedia(media []Media, id int) (Media, bool) {
+	for _, m := range media {
+		if m.Id == id {
+			return m, true
+		}
+	}
+	return Media{}, false
+}
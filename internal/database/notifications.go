@@ -0,0 +1,153 @@
+package database
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	NotificationReply    = "reply"
+	NotificationMention  = "mention"
+	NotificationFollow   = "follow"
+	NotificationReaction = "reaction"
+)
+
+// Notification tells UserId that the actors did something. Follows and
+// reactions are grouped: while unread, further actors are added to the same
+// notification instead of creating a new one.
+type Notification struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	Type      string    `json:"type"`
+	ActorIds  []int     `json:"actor_ids"`
+	ChirpId   *int      `json:"chirp_id,omitempty"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (n Notification) GetId() int {
+	return n.Id
+}
+
+func isGroupedNotification(notificationType string) bool {
+	return notificationType == NotificationFollow || notificationType == NotificationReaction
+}
+
+// CreateNotification stores a notification for userId about actorId. It is
+// skipped, returning false, when the user acts on their own content, when a
+// block or mute separates the two users, or when the user cannot see the
+// chirp involved.
+func (db *DB) CreateNotification(userId int, notificationType string, actorId int, chirpId *int) (Notification, bool, error) {
+	var notification Notification
+	created := false
+	err := db.update(func(dbStruct *DBStructure) error {
+		if userId == actorId ||
+			!userExists(dbStruct.Users, userId) ||
+			isBlockedBetween(*dbStruct, userId, actorId) ||
+			hasRelation(dbStruct.Mutes, userId, actorId) {
+			return nil
+		}
+		if chirpId != nil {
+			chirp, ok := findChirp(dbStruct.Chirps, *chirpId)
+			if !ok || !canView(*dbStruct, chirp, userId) {
+				return nil
+			}
+		}
+
+		created = true
+		now := time.Now().UTC()
+		if isGroupedNotification(notificationType) {
+			for i, n := range dbStruct.Notifications {
+				if n.UserId == userId && n.Type == notificationType && !n.Read && sameChirp(n.ChirpId, chirpId) {
+					grouped := &dbStruct.Notifications[i]
+					if !slices.Contains(grouped.ActorIds, actorId) {
+						grouped.ActorIds = append(grouped.ActorIds, actorId)
+					}
+					grouped.UpdatedAt = now
+					notification = *grouped
+					return nil
+				}
+			}
+		}
+
+		notification = Notification{
+			Id:        nextId(dbStruct, "notifications", dbStruct.Notifications),
+			UserId:    userId,
+			Type:      notificationType,
+			ActorIds:  []int{actorId},
+			ChirpId:   chirpId,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		dbStruct.Notifications = append(dbStruct.Notifications, notification)
+		return nil
+	})
+	if err != nil {
+		return Notification{}, false, err
+	}
+	return notification, created, nil
+}
+
+// GetNotifications returns the user's notifications, most recently updated
+// first.
+func (db *DB) GetNotifications(userId int, unreadOnly bool) ([]Notification, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	notifications := []Notification{}
+	for _, n := range dbStruct.Notifications {
+		if n.UserId == userId && (!unreadOnly || !n.Read) {
+			notifications = append(notifications, n)
+		}
+	}
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].UpdatedAt.After(notifications[j].UpdatedAt)
+	})
+	return notifications, nil
+}
+
+// MarkNotificationsRead marks the given notifications, or all of the user's
+// notifications when ids is empty, as read and returns how many changed.
+func (db *DB) MarkNotificationsRead(userId int, ids []int) (int, error) {
+	marked := 0
+	err := db.update(func(dbStruct *DBStructure) error {
+		for i, n := range dbStruct.Notifications {
+			if n.UserId != userId || n.Read {
+				continue
+			}
+			if len(ids) > 0 && !slices.Contains(ids, n.Id) {
+				continue
+			}
+			dbStruct.Notifications[i].Read = true
+			marked++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return marked, nil
+}
+
+func (db *DB) DeleteNotificationsForChirp(chirpId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		kept := []Notification{}
+		for _, n := range dbStruct.Notifications {
+			if n.ChirpId == nil || *n.ChirpId != chirpId {
+				kept = append(kept, n)
+			}
+		}
+		dbStruct.Notifications = kept
+		return nil
+	})
+}
+
+func sameChirp(a *int, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const MaxPinnedChirps = 3
+
+// SetPinnedChirps replaces the user's pinned chirps, keeping the given order.
+// Only the user's own chirps can be pinned.
+func (db *DB) SetPinnedChirps(userId int, chirpIds []int) ([]int, error) {
+	if len(chirpIds) > MaxPinnedChirps {
+		return nil, fmt.Errorf("at most %d chirps can be pinned", MaxPinnedChirps)
+	}
+	pinned := []int{}
+	err := db.update(func(dbStruct *DBStructure) error {
+		for _, chirpId := range chirpIds {
+			chirp, ok := findChirp(dbStruct.Chirps, chirpId)
+			if !ok || chirp.AuthorId != userId {
+				return errors.New("not found")
+			}
+			if !slices.Contains(pinned, chirpId) {
+				pinned = append(pinned, chirpId)
+			}
+		}
+
+		for i, user := range dbStruct.Users {
+			if user.Id == userId {
+				dbStruct.Users[i].PinnedChirpIds = pinned
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
+
+// GetPinnedChirps returns the user's pinned chirps that the viewer is
+// allowed to see.
+func (db *DB) GetPinnedChirps(userId int, viewerId int) ([]Chirp, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range dbStruct.Users {
+		if user.Id != userId {
+			continue
+		}
+		chirps := []Chirp{}
+		for _, chirpId := range user.PinnedChirpIds {
+			chirp, ok := findChirp(dbStruct.Chirps, chirpId)
+			if ok && canView(dbStruct, chirp, viewerId) {
+				chirps = append(chirps, chirp)
+			}
+		}
+		return chirps, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func unpinChirp(users []User, authorId int, chirpId int) {
+	for i, user := range users {
+		if user.Id == authorId {
+			users[i].PinnedChirpIds = slices.DeleteFunc(user.PinnedChirpIds, func(id int) bool {
+				return id == chirpId
+			})
+		}
+	}
+}
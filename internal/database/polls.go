@@ -0,0 +1,156 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+type Poll struct {
+	Options   []string  `json:"options"`
+	Multiple  bool      `json:"multiple"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type PollVote struct {
+	ChirpId   int       `json:"chirp_id"`
+	UserId    int       `json:"user_id"`
+	Choices   []int     `json:"choices"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PollResults is a viewer's view of a poll. Counts are only filled in once
+// the viewer has voted or the poll has closed.
+type PollResults struct {
+	Options    []PollOptionResult `json:"options"`
+	Multiple   bool               `json:"multiple"`
+	ExpiresAt  time.Time          `json:"expires_at"`
+	Closed     bool               `json:"closed"`
+	Voted      bool               `json:"voted"`
+	OwnChoices []int              `json:"own_choices,omitempty"`
+	Voters     *int               `json:"voters,omitempty"`
+}
+
+type PollOptionResult struct {
+	Title string `json:"title"`
+	Votes *int   `json:"votes,omitempty"`
+}
+
+func (p Poll) IsClosed() bool {
+	return !time.Now().UTC().Before(p.ExpiresAt)
+}
+
+func (db *DB) VoteInPoll(chirpId int, userId int, choices []int) (PollResults, error) {
+	// The already-voted check and the vote happen under one lock, so
+	// parallel requests cannot vote twice.
+	var results PollResults
+	err := db.update(func(dbStruct *DBStructure) error {
+		chirp, ok := findChirp(dbStruct.Chirps, chirpId)
+		if !ok || chirp.Poll == nil || !canView(*dbStruct, chirp, userId) {
+			return errors.New("not found")
+		}
+		if chirp.Poll.IsClosed() {
+			return errors.New("poll is closed")
+		}
+		if _, voted := findPollVote(dbStruct.PollVotes, chirpId, userId); voted {
+			return errors.New("already voted")
+		}
+		if !validChoices(*chirp.Poll, choices) {
+			return errors.New("invalid choices")
+		}
+
+		dbStruct.PollVotes = append(dbStruct.PollVotes, PollVote{
+			ChirpId:   chirpId,
+			UserId:    userId,
+			Choices:   choices,
+			CreatedAt: time.Now().UTC(),
+		})
+		results = pollResults(dbStruct.PollVotes, chirp, userId)
+		return nil
+	})
+	if err != nil {
+		return PollResults{}, err
+	}
+	return results, nil
+}
+
+func (db *DB) GetPollResults(chirpId int, viewerId int) (PollResults, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return PollResults{}, err
+	}
+	chirp, ok := findChirp(dbStruct.Chirps, chirpId)
+	if !ok || chirp.Poll == nil || !canView(dbStruct, chirp, viewerId) {
+		return PollResults{}, errors.New("not found")
+	}
+	return pollResults(dbStruct.PollVotes, chirp, viewerId), nil
+}
+
+func pollResults(votes []PollVote, chirp Chirp, viewerId int) PollResults {
+	poll := *chirp.Poll
+	results := PollResults{
+		Multiple:  poll.Multiple,
+		ExpiresAt: poll.ExpiresAt,
+		Closed:    poll.IsClosed(),
+	}
+	if own, ok := findPollVote(votes, chirp.Id, viewerId); ok && viewerId != 0 {
+		results.Voted = true
+		results.OwnChoices = own.Choices
+	}
+
+	counts := make([]int, len(poll.Options))
+	voters := 0
+	for _, vote := range votes {
+		if vote.ChirpId != chirp.Id {
+			continue
+		}
+		voters++
+		for _, choice := range vote.Choices {
+			counts[choice]++
+		}
+	}
+
+	showCounts := results.Voted || results.Closed
+	for i, option := range poll.Options {
+		result := PollOptionResult{Title: option}
+		if showCounts {
+			result.Votes = &counts[i]
+		}
+		results.Options = append(results.Options, result)
+	}
+	if showCounts {
+		results.Voters = &voters
+	}
+	return results
+}
+
+func validChoices(poll Poll, choices []int) bool {
+	if len(choices) == 0 || (!poll.Multiple && len(choices) > 1) {
+		return false
+	}
+	for i, choice := range choices {
+		if choice < 0 || choice >= len(poll.Options) || slices.Contains(choices[:i], choice) {
+			return false
+		}
+	}
+	return true
+}
+
+func findPollVote(votes []PollVote, chirpId int, userId int) (PollVote, bool) {
+	for _, vote := range votes {
+		if vote.ChirpId == chirpId && vote.UserId == userId {
+			return vote, true
+		}
+	}
+	return PollVote{}, false
+}
+
+func removePollVotesForChirp(votes []PollVote, chirpId int) []PollVote {
+	kept := []PollVote{}
+	for _, vote := range votes {
+		if vote.ChirpId != chirpId {
+			kept = append(kept, vote)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"errors"
+	"strings"
+)
+
+// Profile holds the public, user-editable part of a user.
+type Profile struct {
+	Handle        string `json:"handle,omitempty"`
+	DisplayName   string `json:"display_name,omitempty"`
+	Bio           string `json:"bio,omitempty"`
+	AvatarMediaId *int   `json:"avatar_media_id,omitempty"`
+}
+
+func (db *DB) GetUserByHandle(handle string) (User, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return User{}, err
+	}
+	for _, user := range dbStruct.Users {
+		if user.Handle != "" && strings.EqualFold(user.Handle, handle) {
+			return user, nil
+		}
+	}
+	return User{}, errors.New("not found")
+}
+
+// validateProfile checks the parts of a profile that depend on other
+// records: handles are unique regardless of case and avatars must be media
+// the user uploaded.
+func validateProfile(dbStruct DBStructure, user User) error {
+	if user.Handle != "" {
+		for _, other := range dbStruct.Users {
+			if other.Id != user.Id && strings.EqualFold(other.Handle, user.Handle) {
+				return errors.New("handle is taken")
+			}
+		}
+	}
+	if user.AvatarMediaId != nil {
+		media, ok := findMedia(dbStruct.Media, *user.AvatarMediaId)
+		if !ok || media.OwnerId != user.Id {
+			return errors.New("not found")
+		}
+	}
+	return nil
+}
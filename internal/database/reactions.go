@@ -0,0 +1,119 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+type Reaction struct {
+	ChirpId   int       `json:"chirp_id"`
+	UserId    int       `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddReaction records the user's reaction and bumps the per-emoji count
+// stored on the chirp. Reacting twice with the same emoji is a no-op. The
+// duplicate check and the count change happen under one lock, so parallel
+// requests cannot make the count drift from the reactions.
+func (db *DB) AddReaction(chirpId int, userId int, emoji string) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStruct *DBStructure) error {
+		i, ok := findChirpIndex(dbStruct.Chirps, chirpId)
+		if !ok || !canView(*dbStruct, dbStruct.Chirps[i], userId) {
+			return errors.New("not found")
+		}
+		if findReaction(dbStruct.Reactions, chirpId, userId, emoji) >= 0 {
+			chirp = dbStruct.Chirps[i]
+			return nil
+		}
+
+		dbStruct.Reactions = append(dbStruct.Reactions, Reaction{
+			ChirpId:   chirpId,
+			UserId:    userId,
+			Emoji:     emoji,
+			CreatedAt: time.Now().UTC(),
+		})
+		reacted := &dbStruct.Chirps[i]
+		if reacted.Reactions == nil {
+			reacted.Reactions = map[string]int{}
+		}
+		reacted.Reactions[emoji]++
+		chirp = *reacted
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+func (db *DB) RemoveReaction(chirpId int, userId int, emoji string) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStruct *DBStructure) error {
+		i, ok := findChirpIndex(dbStruct.Chirps, chirpId)
+		if !ok || !canView(*dbStruct, dbStruct.Chirps[i], userId) {
+			return errors.New("not found")
+		}
+		j := findReaction(dbStruct.Reactions, chirpId, userId, emoji)
+		if j < 0 {
+			return errors.New("not found")
+		}
+
+		dbStruct.Reactions = append(dbStruct.Reactions[:j], dbStruct.Reactions[j+1:]...)
+		reacted := &dbStruct.Chirps[i]
+		reacted.Reactions[emoji]--
+		if reacted.Reactions[emoji] <= 0 {
+			delete(reacted.Reactions, emoji)
+		}
+		chirp = *reacted
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+// GetUserReactions returns the user's reactions on chirps the viewer can
+// see, newest first.
+func (db *DB) GetUserReactions(userId int, viewerId int) ([]Reaction, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	reactions := []Reaction{}
+	for _, reaction := range dbStruct.Reactions {
+		if reaction.UserId != userId {
+			continue
+		}
+		chirp, ok := findChirp(dbStruct.Chirps, reaction.ChirpId)
+		if ok && canView(dbStruct, chirp, viewerId) {
+			reactions = append(reactions, reaction)
+		}
+	}
+	sort.SliceStable(reactions, func(i, j int) bool {
+		return reactions[i].CreatedAt.After(reactions[j].CreatedAt)
+	})
+	return reactions, nil
+}
+
+func findReaction(reactions []Reaction, chirpId int, userId int, emoji string) int {
+	for i, reaction := range reactions {
+		if reaction.ChirpId == chirpId && reaction.UserId == userId && reaction.Emoji == emoji {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeReactionsForChirp(reactions []Reaction, chirpId int) []Reaction {
+	kept := []Reaction{}
+	for _, reaction := range reactions {
+		if reaction.ChirpId != chirpId {
+			kept = append(kept, reaction)
+		}
+	}
+	return kept
+}
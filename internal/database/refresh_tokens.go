@@ -0,0 +1,138 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// RefreshToken records an issued refresh token by its JWT id. Tokens issued
+// by rotating another one share its FamilyId, which starts at login.
+type RefreshToken struct {
+	Id        string     `json:"id"`
+	FamilyId  string     `json:"family_id"`
+	UserId    int        `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (db *DB) CreateRefreshToken(token RefreshToken) (RefreshToken, error) {
+	token.CreatedAt = time.Now().UTC()
+	err := db.update(func(dbStruct *DBStructure) error {
+		dbStruct.RefreshTokens = append(dbStruct.RefreshTokens, token)
+		return nil
+	})
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken marks the token with oldId as used and stores next in
+// its place. Presenting a token that was already rotated means it has been
+// replayed, so the whole family is revoked and an error is returned.
+func (db *DB) RotateRefreshToken(oldId string, next RefreshToken) (RefreshToken, error) {
+	// The check that the token was not rotated yet and the rotation happen
+	// under one lock, so concurrent refreshes with the same token cannot
+	// both succeed.
+	reused := false
+	err := db.update(func(dbStruct *DBStructure) error {
+		i, ok := findRefreshToken(dbStruct.RefreshTokens, oldId)
+		if !ok {
+			return errors.New("not found")
+		}
+		old := &dbStruct.RefreshTokens[i]
+		now := time.Now().UTC()
+		if old.RevokedAt != nil {
+			return errors.New("token is revoked")
+		}
+		if old.RotatedAt != nil {
+			revokeFamily(dbStruct, old.FamilyId, now)
+			reused = true
+			return nil
+		}
+
+		old.RotatedAt = &now
+		next.FamilyId = old.FamilyId
+		next.UserId = old.UserId
+		next.CreatedAt = now
+		dbStruct.RefreshTokens = append(dbStruct.RefreshTokens, next)
+		return nil
+	})
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if reused {
+		return RefreshToken{}, errors.New("token reuse detected")
+	}
+	return next, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token in the family of the token
+// with the given id.
+func (db *DB) RevokeRefreshTokenFamily(id string) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		i, ok := findRefreshToken(dbStruct.RefreshTokens, id)
+		if !ok {
+			return errors.New("not found")
+		}
+		revokeFamily(dbStruct, dbStruct.RefreshTokens[i].FamilyId, time.Now().UTC())
+		return nil
+	})
+}
+
+// RevokeUserCredentials ends everything that authenticates the user
+// without their password: every refresh token family, and so every
+// session, and every API key. It is used when the password is reset.
+func (db *DB) RevokeUserCredentials(userId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		familyIds := map[string]bool{}
+		for _, token := range dbStruct.RefreshTokens {
+			if token.UserId == userId {
+				familyIds[token.FamilyId] = true
+			}
+		}
+		now := time.Now().UTC()
+		for familyId := range familyIds {
+			revokeFamily(dbStruct, familyId, now)
+		}
+		deleteUserApiKeys(dbStruct, userId)
+		return nil
+	})
+}
+
+// revokeFamily revokes every token of the family, adds their ids to the
+// Revokes store and ends the session the family belongs to.
+func revokeFamily(dbStruct *DBStructure, familyId string, now time.Time) {
+	if dbStruct.Revokes == nil {
+		dbStruct.Revokes = map[string]time.Time{}
+	}
+	for i, token := range dbStruct.RefreshTokens {
+		if token.FamilyId != familyId {
+			continue
+		}
+		if token.RevokedAt == nil {
+			dbStruct.RefreshTokens[i].RevokedAt = &now
+		}
+		if _, ok := dbStruct.Revokes[token.Id]; !ok {
+			dbStruct.Revokes[token.Id] = now
+		}
+	}
+	sessions := []Session{}
+	for _, session := range dbStruct.Sessions {
+		if session.FamilyId != familyId {
+			sessions = append(sessions, session)
+		}
+	}
+	dbStruct.Sessions = sessions
+}
+
+func findRefreshToken(tokens []RefreshToken, id string) (int, bool) {
+	for i, token := range tokens {
+		if token.Id == id {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// UserRelation is a directed relation from UserId to TargetId, used for
+// both blocks and mutes.
+type UserRelation struct {
+	UserId    int       `json:"user_id"`
+	TargetId  int       `json:"target_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) BlockUser(userId int, targetId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		blocks, err := addRelation(*dbStruct, dbStruct.Blocks, userId, targetId)
+		if err != nil {
+			return err
+		}
+		dbStruct.Blocks = blocks
+		dbStruct.Follows = dropRelation(dbStruct.Follows, userId, targetId)
+		dbStruct.Follows = dropRelation(dbStruct.Follows, targetId, userId)
+		return nil
+	})
+}
+
+func (db *DB) UnblockUser(userId int, targetId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		blocks, err := removeRelation(dbStruct.Blocks, userId, targetId)
+		if err != nil {
+			return err
+		}
+		dbStruct.Blocks = blocks
+		return nil
+	})
+}
+
+func (db *DB) MuteUser(userId int, targetId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		mutes, err := addRelation(*dbStruct, dbStruct.Mutes, userId, targetId)
+		if err != nil {
+			return err
+		}
+		dbStruct.Mutes = mutes
+		return nil
+	})
+}
+
+func (db *DB) UnmuteUser(userId int, targetId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		mutes, err := removeRelation(dbStruct.Mutes, userId, targetId)
+		if err != nil {
+			return err
+		}
+		dbStruct.Mutes = mutes
+		return nil
+	})
+}
+
+func (db *DB) FollowUser(userId int, targetId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		if isBlockedBetween(*dbStruct, userId, targetId) {
+			return errors.New("user is blocked")
+		}
+		follows, err := addRelation(*dbStruct, dbStruct.Follows, userId, targetId)
+		if err != nil {
+			return err
+		}
+		dbStruct.Follows = follows
+		return nil
+	})
+}
+
+func (db *DB) UnfollowUser(userId int, targetId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		follows, err := removeRelation(dbStruct.Follows, userId, targetId)
+		if err != nil {
+			return err
+		}
+		dbStruct.Follows = follows
+		return nil
+	})
+}
+
+// IsBlockedBetween reports whether either user has blocked the other.
+func (db *DB) IsBlockedBetween(a int, b int) (bool, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return false, err
+	}
+	return isBlockedBetween(dbStruct, a, b), nil
+}
+
+func isBlockedBetween(dbStruct DBStructure, a int, b int) bool {
+	return hasRelation(dbStruct.Blocks, a, b) || hasRelation(dbStruct.Blocks, b, a)
+}
+
+// GetHiddenAuthorIds returns the authors whose chirps should not appear in
+// the viewer's timeline: users blocked in either direction and users the
+// viewer has muted.
+func (db *DB) GetHiddenAuthorIds(viewerId int) (map[int]bool, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	hidden := blockedAuthorIds(dbStruct, viewerId)
+	for _, mute := range dbStruct.Mutes {
+		if mute.UserId == viewerId {
+			hidden[mute.TargetId] = true
+		}
+	}
+	return hidden, nil
+}
+
+func blockedAuthorIds(dbStruct DBStructure, viewerId int) map[int]bool {
+	blocked := map[int]bool{}
+	for _, block := range dbStruct.Blocks {
+		if block.UserId == viewerId {
+			blocked[block.TargetId] = true
+		}
+		if block.TargetId == viewerId {
+			blocked[block.UserId] = true
+		}
+	}
+	return blocked
+}
+
+func addRelation(dbStruct DBStructure, relations []UserRelation, userId int, targetId int) ([]UserRelation, error) {
+	if userId == targetId {
+		return nil, errors.New("cannot target yourself")
+	}
+	if !userExists(dbStruct.Users, targetId) {
+		return nil, errors.New("not found")
+	}
+	if hasRelation(relations, userId, targetId) {
+		return relations, nil
+	}
+	relation := UserRelation{
+		UserId:    userId,
+		TargetId:  targetId,
+		CreatedAt: time.Now().UTC(),
+	}
+	return append(relations, relation), nil
+}
+
+func removeRelation(relations []UserRelation, userId int, targetId int) ([]UserRelation, error) {
+	for i, relation := range relations {
+		if relation.UserId == userId && relation.TargetId == targetId {
+			return append(relations[:i], relations[i+1:]...), nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func dropRelation(relations []UserRelation, userId int, targetId int) []UserRelation {
+	kept := []UserRelation{}
+	for _, relation := range relations {
+		if relation.UserId != userId || relation.TargetId != targetId {
+			kept = append(kept, relation)
+		}
+	}
+	return kept
+}
+
+func hasRelation(relations []UserRelation, userId int, targetId int) bool {
+	for _, relation := range relations {
+		if relation.UserId == userId && relation.TargetId == targetId {
+			return true
+		}
+	}
+	return false
+}
@@ -6,16 +6,10 @@ import (
 )
 
 func (db *DB) RevokeToken(token string) error {
-	dbStruct, err := db.loadDB()
-	if err != nil {
-		return err
-	}
-	dbStruct.Revokes[token] = time.Now()
-	err = db.writeDb(dbStruct)
-	if err != nil {
-		return err
-	}
-	return nil
+	return db.update(func(dbStruct *DBStructure) error {
+		dbStruct.Revokes[token] = time.Now()
+		return nil
+	})
 }
 
 func (db *DB) IsTokenRevoked(token string) bool {
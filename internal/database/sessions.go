@@ -0,0 +1,125 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Session is one login of a user on a device. It follows the refresh token
+// family started by that login.
+type Session struct {
+	Id             int       `json:"id"`
+	UserId         int       `json:"user_id"`
+	FamilyId       string    `json:"family_id"`
+	RefreshTokenId string    `json:"refresh_token_id"`
+	UserAgent      string    `json:"user_agent"`
+	Ip             string    `json:"ip"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastUsedAt     time.Time `json:"last_used_at"`
+}
+
+func (s Session) GetId() int {
+	return s.Id
+}
+
+func (db *DB) CreateSession(session Session) (Session, error) {
+	now := time.Now().UTC()
+	session.CreatedAt = now
+	session.LastUsedAt = now
+	err := db.update(func(dbStruct *DBStructure) error {
+		session.Id = nextId(dbStruct, "sessions", dbStruct.Sessions)
+		dbStruct.Sessions = append(dbStruct.Sessions, session)
+		return nil
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// TouchSession records that the session's refresh token was rotated to
+// refreshTokenId.
+func (db *DB) TouchSession(familyId string, refreshTokenId string) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		for i, session := range dbStruct.Sessions {
+			if session.FamilyId == familyId {
+				dbStruct.Sessions[i].RefreshTokenId = refreshTokenId
+				dbStruct.Sessions[i].LastUsedAt = time.Now().UTC()
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+}
+
+// HasSession reports whether the session of the refresh token family is
+// still active.
+func (db *DB) HasSession(familyId string) (bool, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return false, err
+	}
+	for _, session := range dbStruct.Sessions {
+		if session.FamilyId == familyId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetSessions returns the user's active sessions, most recently used first.
+func (db *DB) GetSessions(userId int) ([]Session, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	sessions := []Session{}
+	for _, session := range dbStruct.Sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (db *DB) RevokeSession(id int, userId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		for _, session := range dbStruct.Sessions {
+			if session.Id == id && session.UserId == userId {
+				revokeFamily(dbStruct, session.FamilyId, time.Now().UTC())
+				return nil
+			}
+		}
+		return errors.New("not found")
+	})
+}
+
+// RevokeAllSessions logs the user out everywhere and returns how many
+// sessions were ended. The user's API keys are deleted as well, since
+// logging out everywhere is what users do when they suspect a leak.
+func (db *DB) RevokeAllSessions(userId int) (int, error) {
+	revoked := 0
+	err := db.update(func(dbStruct *DBStructure) error {
+		familyIds := []string{}
+		for _, session := range dbStruct.Sessions {
+			if session.UserId == userId {
+				familyIds = append(familyIds, session.FamilyId)
+			}
+		}
+		now := time.Now().UTC()
+		for _, familyId := range familyIds {
+			revokeFamily(dbStruct, familyId, now)
+		}
+		deleteUserApiKeys(dbStruct, userId)
+		revoked = len(familyIds)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return revoked, nil
+}
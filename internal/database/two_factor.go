@@ -0,0 +1,91 @@
+package database
+
+import (
+	"errors"
+)
+
+// TwoFactor is a user's TOTP enrollment. It is stored while pending and
+// only enforced at login once Enabled is set by a confirmed code.
+type TwoFactor struct {
+	Secret  string `json:"secret"`
+	Enabled bool   `json:"enabled"`
+	// LastUsedStep is the time step of the last accepted code, so a code
+	// cannot be used twice.
+	LastUsedStep       int64    `json:"last_used_step"`
+	RecoveryCodeHashes []string `json:"recovery_code_hashes"`
+}
+
+// StartTwoFactor stores a pending enrollment, replacing any earlier one
+// that was never confirmed.
+func (db *DB) StartTwoFactor(userId int, secret string, recoveryCodeHashes []string) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		user, ok := findUser(dbStruct.Users, userId)
+		if !ok {
+			return errors.New("not found")
+		}
+		if user.TwoFactor != nil && user.TwoFactor.Enabled {
+			return errors.New("two-factor authentication is already enabled")
+		}
+		user.TwoFactor = &TwoFactor{
+			Secret:             secret,
+			RecoveryCodeHashes: recoveryCodeHashes,
+		}
+		return nil
+	})
+}
+
+// UseTwoFactorStep records that the code for step was accepted, and
+// enables a pending enrollment. It fails for steps that were already used.
+func (db *DB) UseTwoFactorStep(userId int, step int64) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		user, ok := findUser(dbStruct.Users, userId)
+		if !ok || user.TwoFactor == nil {
+			return errors.New("not found")
+		}
+		if step <= user.TwoFactor.LastUsedStep {
+			return errors.New("code was already used")
+		}
+		user.TwoFactor.LastUsedStep = step
+		user.TwoFactor.Enabled = true
+		return nil
+	})
+}
+
+// UseRecoveryCode removes the recovery code with the given hash, so each
+// code works once.
+func (db *DB) UseRecoveryCode(userId int, codeHash string) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		user, ok := findUser(dbStruct.Users, userId)
+		if !ok || user.TwoFactor == nil || !user.TwoFactor.Enabled {
+			return errors.New("not found")
+		}
+		for i, hash := range user.TwoFactor.RecoveryCodeHashes {
+			if hash == codeHash {
+				hashes := user.TwoFactor.RecoveryCodeHashes
+				user.TwoFactor.RecoveryCodeHashes = append(hashes[:i], hashes[i+1:]...)
+				return nil
+			}
+		}
+		return errors.New("invalid code")
+	})
+}
+
+func (db *DB) DisableTwoFactor(userId int) error {
+	return db.update(func(dbStruct *DBStructure) error {
+		user, ok := findUser(dbStruct.Users, userId)
+		if !ok {
+			return errors.New("not found")
+		}
+		user.TwoFactor = nil
+		return nil
+	})
+}
+
+func findUser(users []User, id int) (*User, bool) {
+	for i := range users {
+		if users[i].Id == id {
+			return &users[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+// UserToken is a single-use token mailed to a user. Only a hash of the
+// token is stored. Email is the address the token was sent to, so a token
+// stops working once the user changes their address.
+type UserToken struct {
+	Purpose   string    `json:"purpose"`
+	TokenHash string    `json:"token_hash"`
+	UserId    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateUserToken stores the token, replacing any earlier token the user
+// has for the same purpose so only the latest email works.
+func (db *DB) CreateUserToken(token UserToken) (UserToken, error) {
+	token.CreatedAt = time.Now().UTC()
+	err := db.update(func(dbStruct *DBStructure) error {
+		if !userExists(dbStruct.Users, token.UserId) {
+			return errors.New("not found")
+		}
+		kept := []UserToken{}
+		for _, t := range dbStruct.UserTokens {
+			if t.UserId != token.UserId || t.Purpose != token.Purpose {
+				kept = append(kept, t)
+			}
+		}
+		dbStruct.UserTokens = append(kept, token)
+		return nil
+	})
+	if err != nil {
+		return UserToken{}, err
+	}
+	return token, nil
+}
+
+// VerifyEmail consumes an email verification token and marks its user as
+// verified.
+func (db *DB) VerifyEmail(tokenHash string) (User, error) {
+	var verified User
+	err := db.update(func(dbStruct *DBStructure) error {
+		token, err := consumeUserToken(dbStruct, TokenPurposeVerifyEmail, tokenHash)
+		if err != nil {
+			return err
+		}
+		for i, user := range dbStruct.Users {
+			if user.Id == token.UserId && user.Email == token.Email {
+				dbStruct.Users[i].Verified = true
+				verified = dbStruct.Users[i]
+				return nil
+			}
+		}
+		return errors.New("invalid token")
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return verified, nil
+}
+
+// GetUserToken returns the token without using it up, so a request can be
+// validated before the token is consumed.
+func (db *DB) GetUserToken(purpose string, tokenHash string) (UserToken, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return UserToken{}, err
+	}
+	for _, token := range dbStruct.UserTokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash {
+			if time.Now().UTC().After(token.ExpiresAt) {
+				return UserToken{}, errors.New("invalid token")
+			}
+			return token, nil
+		}
+	}
+	return UserToken{}, errors.New("invalid token")
+}
+
+// ConsumeUserToken removes the token so it cannot be used again and
+// returns it.
+func (db *DB) ConsumeUserToken(purpose string, tokenHash string) (UserToken, error) {
+	var token UserToken
+	err := db.update(func(dbStruct *DBStructure) error {
+		var err error
+		token, err = consumeUserToken(dbStruct, purpose, tokenHash)
+		return err
+	})
+	if err != nil {
+		return UserToken{}, err
+	}
+	return token, nil
+}
+
+// consumeUserToken removes the matching token from dbStruct and returns it.
+// Expired tokens are reported as invalid.
+func consumeUserToken(dbStruct *DBStructure, purpose string, tokenHash string) (UserToken, error) {
+	for i, token := range dbStruct.UserTokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash {
+			dbStruct.UserTokens = append(dbStruct.UserTokens[:i], dbStruct.UserTokens[i+1:]...)
+			if time.Now().UTC().After(token.ExpiresAt) {
+				return UserToken{}, errors.New("invalid token")
+			}
+			return token, nil
+		}
+	}
+	return UserToken{}, errors.New("invalid token")
+}
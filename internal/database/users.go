@@ -2,14 +2,20 @@ package database
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	Id       int    `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Id             int        `json:"id"`
+	Email          string     `json:"email"`
+	Password       string     `json:"password"`
+	PinnedChirpIds []int      `json:"pinned_chirp_ids,omitempty"`
+	Verified       bool       `json:"is_verified"`
+	TwoFactor      *TwoFactor `json:"two_factor,omitempty"`
+	Profile
 }
 
 func (u User) GetId() int {
@@ -17,61 +23,100 @@ func (u User) GetId() int {
 }
 
 func (db *DB) CreateUser(email string, password string) (User, error) {
-	dbStruct, err := db.loadDB()
-	if err != nil {
-		log.Println("Error loading db")
-		return User{}, err
-	}
-	_, err = db.GetUserByEmail(email)
-	if err == nil {
-		log.Println("a user with that email already exists")
-		return User{}, errors.New("a user with that email already exists")
+	if password == "" {
+		return User{}, errors.New("password is required")
 	}
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashed, err := db.HashPassword(password)
 	if err != nil {
 		log.Println("Error hashing password")
 		return User{}, err
 	}
-	id := calculateId(dbStruct.Users)
-	user := User{
-		Id:       id,
-		Email:    email,
-		Password: string(hashed),
-	}
-	dbStruct.Users = append(dbStruct.Users, user)
-	err = db.writeDb(dbStruct)
+	var user User
+	err = db.update(func(dbStruct *DBStructure) error {
+		if emailTaken(dbStruct.Users, email, 0) {
+			log.Println("a user with that email already exists")
+			return errors.New("a user with that email already exists")
+		}
+		user = User{
+			Id:       nextId(dbStruct, "users", dbStruct.Users),
+			Email:    email,
+			Password: hashed,
+		}
+		dbStruct.Users = append(dbStruct.Users, user)
+		return nil
+	})
 	if err != nil {
-		log.Println("Error writing db")
 		return User{}, err
 	}
 	return user, nil
 }
 
+// UpdateUser replaces the stored user. The password is hashed before it is
+// stored; an empty password keeps the current hash. Emails are unique
+// regardless of case. Two-factor state and pins have their own writers, so
+// the stored ones are kept rather than those the caller loaded earlier.
 func (db *DB) UpdateUser(user User) (User, error) {
-	dbStruct, err := db.loadDB()
-	if err != nil {
-		return User{}, err
+	if user.Password != "" {
+		hashed, err := db.HashPassword(user.Password)
+		if err != nil {
+			return User{}, err
+		}
+		user.Password = hashed
 	}
-
-	for i, dbUser := range dbStruct.Users {
-		if dbUser.Id == user.Id {
-			hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-			if err != nil {
-				return User{}, err
+	err := db.update(func(dbStruct *DBStructure) error {
+		for i, dbUser := range dbStruct.Users {
+			if dbUser.Id != user.Id {
+				continue
 			}
-			user.Password = string(hashed)
-			dbStruct.Users[i] = user
-			err = db.writeDb(dbStruct)
+			if user.Email != dbUser.Email && emailTaken(dbStruct.Users, user.Email, user.Id) {
+				return errors.New("email is taken")
+			}
+			err := validateProfile(*dbStruct, user)
 			if err != nil {
-				return User{}, err
+				return err
+			}
+			if user.Password == "" {
+				user.Password = dbUser.Password
+			}
+			user.TwoFactor = dbUser.TwoFactor
+			user.PinnedChirpIds = dbUser.PinnedChirpIds
+			if user.Email == dbUser.Email {
+				user.Verified = user.Verified || dbUser.Verified
 			}
-			return dbStruct.Users[i], nil
+			dbStruct.Users[i] = user
+			return nil
 		}
-	}
+		return errors.New("user does not exist")
+	})
 	if err != nil {
 		return User{}, err
 	}
-	return User{}, errors.New("user does not exist")
+	return user, nil
+}
+
+// SetPasswordCost sets the bcrypt cost new password hashes are made with.
+func (db *DB) SetPasswordCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	db.passwordCost = cost
+	return nil
+}
+
+// HashPassword hashes the password with the configured bcrypt cost.
+func (db *DB) HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), db.passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// PasswordNeedsRehash reports whether the hash was made with a lower cost
+// than the configured one.
+func (db *DB) PasswordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < db.passwordCost
 }
 
 func (db *DB) GetUserByEmail(email string) (User, error) {
@@ -80,7 +125,7 @@ func (db *DB) GetUserByEmail(email string) (User, error) {
 		return User{}, err
 	}
 	for _, user := range dbStruct.Users {
-		if user.Email == email {
+		if strings.EqualFold(user.Email, email) {
 			return user, nil
 		}
 	}
@@ -121,3 +166,23 @@ func (db *DB) GetUsers() ([]User, error) {
 	}
 	return dbStruct.Users, nil
 }
+
+// emailTaken reports whether a user other than exceptId has the email,
+// ignoring case.
+func emailTaken(users []User, email string, exceptId int) bool {
+	for _, user := range users {
+		if user.Id != exceptId && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func userExists(users []User, id int) bool {
+	for _, user := range users {
+		if user.Id == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"errors"
+	"slices"
+)
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityDirect    = "direct"
+)
+
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPublic, VisibilityFollowers, VisibilityDirect:
+		return true
+	}
+	return false
+}
+
+// GetVisibleChirp returns the chirp only if the viewer is allowed to see it.
+// A viewerId of 0 is an anonymous viewer. Chirps the viewer may not see are
+// reported as not found so their existence is not leaked.
+func (db *DB) GetVisibleChirp(id int, viewerId int) (Chirp, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return Chirp{}, err
+	}
+	for _, chirp := range dbStruct.Chirps {
+		if chirp.Id == id && canView(dbStruct, chirp, viewerId) {
+			return chirp, nil
+		}
+	}
+	return Chirp{}, errors.New("not found")
+}
+
+func (db *DB) GetVisibleChirps(viewerId int) ([]Chirp, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+	return visibleChirps(dbStruct, dbStruct.Chirps, viewerId), nil
+}
+
+// CanViewChirp checks the given chirp rather than the stored one, so it also
+// works for chirps that have just been deleted.
+func (db *DB) CanViewChirp(chirp Chirp, viewerId int) (bool, error) {
+	dbStruct, err := db.loadDB()
+	if err != nil {
+		return false, err
+	}
+	return canView(dbStruct, chirp, viewerId), nil
+}
+
+func visibleChirps(dbStruct DBStructure, chirps []Chirp, viewerId int) []Chirp {
+	visible := []Chirp{}
+	for _, chirp := range chirps {
+		if canView(dbStruct, chirp, viewerId) {
+			visible = append(visible, chirp)
+		}
+	}
+	return visible
+}
+
+func canView(dbStruct DBStructure, chirp Chirp, viewerId int) bool {
+	if viewerId == chirp.AuthorId {
+		return true
+	}
+	if viewerId != 0 && isBlockedBetween(dbStruct, viewerId, chirp.AuthorId) {
+		return false
+	}
+	switch chirp.Visibility {
+	case VisibilityPublic, "":
+		return true
+	case VisibilityFollowers:
+		return viewerId != 0 && hasRelation(dbStruct.Follows, viewerId, chirp.AuthorId)
+	case VisibilityDirect:
+		return viewerId != 0 && slices.Contains(chirp.RecipientIds, viewerId)
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+// Package events is an in-process bus for domain events raised by the API
+// handlers, so features such as notifications can react to them without
+// the handlers knowing about each of them.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/like2foxes/chirpy/internal/database"
+)
+
+type Type string
+
+const (
+	ChirpCreated        Type = "chirp_created"
+	ChirpUpdated        Type = "chirp_updated"
+	ChirpDeleted        Type = "chirp_deleted"
+	UserFollowed        Type = "user_followed"
+	ReactionAdded       Type = "reaction_added"
+	NotificationCreated Type = "notification_created"
+	MessageCreated      Type = "message_created"
+)
+
+type Event struct {
+	Type    Type
+	ActorId int
+	// Chirp is set for chirp and reaction events.
+	Chirp *database.Chirp
+	// TargetUserId is the followed user for UserFollowed.
+	TargetUserId int
+	Emoji        string
+	// Notification is set for NotificationCreated.
+	Notification *database.Notification
+	// Message and RecipientIds are set for MessageCreated.
+	Message      *database.Message
+	RecipientIds []int
+	Time         time.Time
+}
+
+type Handler func(Event)
+
+type Bus struct {
+	mux      *sync.RWMutex
+	handlers []Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		mux: &sync.RWMutex{},
+	}
+}
+
+func (b *Bus) Subscribe(handler Handler) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish hands the event to every subscriber in turn. Handlers run on the
+// publisher's goroutine and must not block.
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	b.mux.RLock()
+	handlers := b.handlers
+	b.mux.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
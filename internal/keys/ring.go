@@ -0,0 +1,210 @@
+// Package keys holds the keys chirpy signs and verifies JWTs with. Tokens
+// are signed with one asymmetric key and carry its id in the kid header;
+// retired keys stay in the ring for verification until the tokens they
+// signed have expired, so keys can be rotated without logging users out.
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Key struct {
+	Id     string
+	Method jwt.SigningMethod
+	Public crypto.PublicKey
+	// Private is nil for keys that are only kept for verification.
+	Private crypto.Signer
+}
+
+type Ring struct {
+	mux     *sync.RWMutex
+	signing *Key
+	keys    map[string]*Key
+	// legacySecret signs and verifies HS256 tokens without a kid while the
+	// ring has no signing key. Once one is loaded, tokens issued before are
+	// only accepted until legacyUntil, to bound the migration.
+	legacySecret []byte
+	legacyUntil  time.Time
+}
+
+func NewRing(legacySecret string) *Ring {
+	ring := &Ring{
+		mux:  &sync.RWMutex{},
+		keys: map[string]*Key{},
+	}
+	if legacySecret != "" {
+		ring.legacySecret = []byte(legacySecret)
+	}
+	return ring
+}
+
+// AcceptLegacyUntil keeps accepting HS256 tokens signed with the legacy
+// secret until the given time after a signing key has been loaded. It
+// should cover the lifetime of the longest-lived token issued before.
+func (ring *Ring) AcceptLegacyUntil(until time.Time) {
+	ring.mux.Lock()
+	defer ring.mux.Unlock()
+	ring.legacyUntil = until
+}
+
+// IsLegacy reports whether a token was verified with the legacy secret
+// although the ring has a signing key, so callers can log such tokens
+// during the migration.
+func (ring *Ring) IsLegacy(token *jwt.Token) bool {
+	ring.mux.RLock()
+	defer ring.mux.RUnlock()
+	kid, _ := token.Header["kid"].(string)
+	return kid == "" && ring.signing != nil
+}
+
+// LoadDir replaces the keys in the ring with the PEM files in dir. Each
+// file is named after its key id: <kid>.pem holds a private key and
+// <kid>.pub.pem a public key kept for verification only. The signing key
+// is signingId, or the private key with the greatest id when it is empty,
+// so date-prefixed ids rotate to the newest key.
+func (ring *Ring) LoadDir(dir string, signingId string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]*Key{}
+	var privateIds []string
+	for _, path := range paths {
+		name := filepath.Base(path)
+		id := strings.TrimSuffix(strings.TrimSuffix(name, ".pem"), ".pub")
+		if _, ok := keys[id]; ok {
+			return fmt.Errorf("duplicate key id %q", id)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := parseKey(id, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		keys[id] = key
+		if key.Private != nil {
+			privateIds = append(privateIds, id)
+		}
+	}
+
+	var signing *Key
+	if signingId != "" {
+		signing = keys[signingId]
+		if signing == nil || signing.Private == nil {
+			return fmt.Errorf("no private key with id %q", signingId)
+		}
+	} else if len(privateIds) > 0 {
+		sort.Strings(privateIds)
+		signing = keys[privateIds[len(privateIds)-1]]
+	}
+
+	ring.mux.Lock()
+	defer ring.mux.Unlock()
+	ring.keys = keys
+	ring.signing = signing
+	return nil
+}
+
+// Sign signs the claims with the signing key, or with the legacy HS256
+// secret when no signing key is loaded.
+func (ring *Ring) Sign(claims jwt.Claims) (string, error) {
+	ring.mux.RLock()
+	defer ring.mux.RUnlock()
+
+	if ring.signing == nil {
+		if ring.legacySecret == nil {
+			return "", errors.New("no signing key")
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(ring.legacySecret)
+	}
+	token := jwt.NewWithClaims(ring.signing.Method, claims)
+	token.Header["kid"] = ring.signing.Id
+	return token.SignedString(ring.signing.Private)
+}
+
+// Keyfunc looks up the verification key for a token by its kid header. It
+// rejects tokens whose algorithm does not match the key, so a public key
+// can never be used as an HMAC secret, and legacy tokens once their
+// migration window has passed.
+func (ring *Ring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	ring.mux.RLock()
+	defer ring.mux.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if ring.legacySecret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("token has no key id")
+		}
+		if ring.signing != nil && !time.Now().Before(ring.legacyUntil) {
+			return nil, errors.New("legacy tokens are no longer accepted")
+		}
+		return ring.legacySecret, nil
+	}
+	key, ok := ring.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown key id")
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.Public, nil
+}
+
+func parseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{Id: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Public, key.Private = jwt.SigningMethodRS256, &k.PublicKey, k
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Public, key.Private = jwt.SigningMethodEdDSA, k.Public(), k
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, errors.New("unsupported key type, use RSA or Ed25519")
+	}
+	if k, ok := key.Public.(*rsa.PublicKey); ok && k.N.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must be at least 2048 bits")
+	}
+	return key, nil
+}
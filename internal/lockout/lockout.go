@@ -0,0 +1,157 @@
+// Package lockout slows down password guessing. It counts failed attempts
+// per key, such as an account or a client IP, and makes the key wait
+// exponentially longer after each failure past a free allowance, up to a
+// temporary lockout. State is kept in memory and lost on restart.
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+type Policy struct {
+	// FreeAttempts is how many failures are allowed before backoff starts.
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// LockoutAttempts is the number of failures that locks the key for
+	// LockoutDuration.
+	LockoutAttempts int
+	LockoutDuration time.Duration
+	// Window is how long after the last failure a key is forgotten.
+	Window time.Duration
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	blockedTill time.Time
+	// pending counts attempts that were begun but have not failed or
+	// succeeded yet.
+	pending int
+}
+
+type Tracker struct {
+	mux        *sync.Mutex
+	policy     Policy
+	entries    map[string]*entry
+	lastPruned time.Time
+}
+
+func NewTracker(policy Policy) *Tracker {
+	return &Tracker{
+		mux:     &sync.Mutex{},
+		policy:  policy,
+		entries: map[string]*entry{},
+	}
+}
+
+// Begin reserves an attempt for the key, or reports how long it has to
+// wait. Attempts in flight count as failures until they finish, so a burst
+// of parallel requests gets no more tries than sequential ones: within the
+// free allowance several may run at once, past it only one at a time.
+// Every attempt that was begun must end with Fail, Done or Reset.
+func (t *Tracker) Begin(key string, now time.Time) (time.Duration, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.prune(now)
+	e, ok := t.entries[key]
+	if !ok {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	t.forgetExpired(e, now)
+	if now.Before(e.blockedTill) {
+		return e.blockedTill.Sub(now), false
+	}
+	if e.pending > 0 && e.failures+e.pending >= t.policy.FreeAttempts {
+		return t.policy.BaseDelay, false
+	}
+	e.pending++
+	return 0, true
+}
+
+// Fail ends a begun attempt as failed and returns how long the key now has
+// to wait, which is zero within the free allowance.
+func (t *Tracker) Fail(key string, now time.Time) time.Duration {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.prune(now)
+	e, ok := t.entries[key]
+	if !ok {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	if e.pending > 0 {
+		e.pending--
+	}
+	t.forgetExpired(e, now)
+	e.failures++
+	e.lastFailure = now
+
+	var delay time.Duration
+	switch {
+	case e.failures >= t.policy.LockoutAttempts:
+		delay = t.policy.LockoutDuration
+	case e.failures > t.policy.FreeAttempts:
+		delay = t.policy.BaseDelay << (e.failures - t.policy.FreeAttempts - 1)
+		if delay > t.policy.MaxDelay || delay <= 0 {
+			delay = t.policy.MaxDelay
+		}
+	}
+	e.blockedTill = now.Add(delay)
+	return delay
+}
+
+// Done ends a begun attempt that did not fail, without forgetting earlier
+// failures.
+func (t *Tracker) Done(key string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	e, ok := t.entries[key]
+	if ok && e.pending > 0 {
+		e.pending--
+	}
+}
+
+// Reset forgets the failures of the key, after a successful attempt or
+// when an administrator unlocks it. Attempts still in flight stay counted.
+func (t *Tracker) Reset(key string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok {
+		return
+	}
+	if e.pending == 0 {
+		delete(t.entries, key)
+		return
+	}
+	e.failures = 0
+	e.blockedTill = time.Time{}
+}
+
+// forgetExpired clears failures that are older than the window.
+func (t *Tracker) forgetExpired(e *entry, now time.Time) {
+	if e.failures > 0 && now.Sub(e.lastFailure) > t.policy.Window && !now.Before(e.blockedTill) {
+		e.failures = 0
+	}
+}
+
+// prune drops forgotten keys at most once per window, so addresses that
+// try once do not accumulate.
+func (t *Tracker) prune(now time.Time) {
+	if now.Sub(t.lastPruned) < t.policy.Window {
+		return
+	}
+	for key, e := range t.entries {
+		if e.pending == 0 && now.Sub(e.lastFailure) > t.policy.Window && !now.Before(e.blockedTill) {
+			delete(t.entries, key)
+		}
+	}
+	t.lastPruned = now
+}
@@ -0,0 +1,130 @@
+package lockout
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAttempts: 5,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+func TestConcurrentAttemptsCannotExceedAllowance(t *testing.T) {
+	tracker := NewTracker(testPolicy)
+	now := time.Now()
+
+	// Every attempt fails, but only after all of them have asked to begin,
+	// as a burst of parallel wrong passwords would.
+	const attempts = 50
+	var allowed atomic.Int32
+	var begun sync.WaitGroup
+	var finished sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		begun.Add(1)
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			<-start
+			_, ok := tracker.Begin("key", now)
+			begun.Done()
+			if !ok {
+				return
+			}
+			allowed.Add(1)
+			begun.Wait()
+			tracker.Fail("key", now)
+		}()
+	}
+	close(start)
+	finished.Wait()
+
+	if got := allowed.Load(); got != int32(testPolicy.FreeAttempts) {
+		t.Errorf("%d parallel attempts were allowed, want %d", got, testPolicy.FreeAttempts)
+	}
+	if _, ok := tracker.Begin("key", now); !ok {
+		t.Fatal("next attempt refused although no delay applies yet")
+	}
+	if got := tracker.Fail("key", now); got != testPolicy.BaseDelay {
+		t.Errorf("failure past the allowance: delay %s, want %s", got, testPolicy.BaseDelay)
+	}
+}
+
+func TestAttemptsPastAllowanceRunOneAtATime(t *testing.T) {
+	tracker := NewTracker(testPolicy)
+	now := time.Now()
+	for i := 0; i < testPolicy.FreeAttempts-1; i++ {
+		tracker.Begin("key", now)
+		tracker.Fail("key", now)
+	}
+
+	if _, ok := tracker.Begin("key", now); !ok {
+		t.Fatal("last free attempt was refused")
+	}
+	if _, ok := tracker.Begin("key", now); ok {
+		t.Fatal("second attempt allowed while the last free one is in flight")
+	}
+	tracker.Done("key")
+	if _, ok := tracker.Begin("key", now); !ok {
+		t.Fatal("attempt refused after the one in flight succeeded")
+	}
+}
+
+func TestFailuresBackOffAndLock(t *testing.T) {
+	tracker := NewTracker(testPolicy)
+	now := time.Now()
+
+	tests := []time.Duration{0, 0, 0, time.Second, 15 * time.Minute}
+	for i, want := range tests {
+		wait, ok := tracker.Begin("key", now)
+		if !ok {
+			t.Fatalf("attempt %d refused, wait %s", i+1, wait)
+		}
+		if got := tracker.Fail("key", now); got != want {
+			t.Errorf("failure %d: delay %s, want %s", i+1, got, want)
+		}
+		now = now.Add(want)
+	}
+	if wait, ok := tracker.Begin("key", now.Add(-time.Minute)); ok || wait != time.Minute {
+		t.Errorf("Begin during lockout = %s, %t, want %s, false", wait, ok, time.Minute)
+	}
+}
+
+func TestResetForgetsFailures(t *testing.T) {
+	tracker := NewTracker(testPolicy)
+	now := time.Now()
+	for i := 0; i < testPolicy.LockoutAttempts; i++ {
+		tracker.Begin("key", now)
+		tracker.Fail("key", now)
+	}
+	if _, ok := tracker.Begin("key", now); ok {
+		t.Fatal("locked key was allowed")
+	}
+
+	tracker.Reset("key")
+	if _, ok := tracker.Begin("key", now); !ok {
+		t.Error("key still locked after Reset")
+	}
+}
+
+func TestFailuresExpireAfterWindow(t *testing.T) {
+	tracker := NewTracker(testPolicy)
+	now := time.Now()
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		tracker.Begin("key", now)
+		tracker.Fail("key", now)
+	}
+
+	later := now.Add(testPolicy.Window + time.Second)
+	tracker.Begin("key", later)
+	if got := tracker.Fail("key", later); got != 0 {
+		t.Errorf("failure after the window: delay %s, want 0", got)
+	}
+}
@@ -0,0 +1,86 @@
+// Package mail sends the transactional emails chirpy needs, such as
+// address verification. Production uses SMTP; local development can write
+// messages to disk or the log instead.
+package mail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// bytes renders the message as a plain text RFC 5322 email.
+func (msg Message) bytes(from string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+type SMTPMailer struct {
+	// Addr is the host:port of the SMTP server. The connection is upgraded
+	// with STARTTLS when the server offers it.
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, msg.bytes(m.From))
+}
+
+// FileMailer writes each message to an .eml file in Dir, or to the log when
+// Dir is empty. It is meant for local development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m FileMailer) Send(msg Message) error {
+	if m.Dir == "" {
+		log.Printf("Mail to %s: %s\n%s\n", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+	err := os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+	// The recipient may contain characters that are not safe in a file
+	// name, such as slashes, so only a hash of it is used.
+	sum := sha256.Sum256([]byte(msg.To))
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), hex.EncodeToString(sum[:8]))
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.bytes(m.From), 0o600)
+}
@@ -0,0 +1,63 @@
+package media
+
+import (
+	"errors"
+)
+
+var errInvalidGif = errors.New("invalid gif")
+
+// gifFrameCount counts the images in a GIF by walking its blocks without
+// decompressing any of them, so the cost of decoding can be bounded first.
+func gifFrameCount(data []byte) (int, error) {
+	// Header and logical screen descriptor.
+	if len(data) < 13 {
+		return 0, errInvalidGif
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension: label, then data sub-blocks
+			pos += 2
+		case 0x2c: // image descriptor, local color table, LZW code size
+			if pos+10 > len(data) {
+				return 0, errInvalidGif
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++
+			frames++
+		case 0x3b: // trailer
+			return frames, nil
+		default:
+			return 0, errInvalidGif
+		}
+		pos = skipSubBlocks(data, pos)
+		if pos < 0 {
+			return 0, errInvalidGif
+		}
+	}
+	// A truncated file is left for the decoder to reject.
+	return frames, nil
+}
+
+// skipSubBlocks returns the position after the sub-blocks starting at pos,
+// or -1 if they run past the end of data.
+func skipSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos
+		}
+		pos += size
+	}
+	return -1
+}
@@ -0,0 +1,126 @@
+// Package media decodes uploaded images and derives the variants served
+// alongside them.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	// MaxPixels bounds the area of an upload. Small files can declare huge
+	// dimensions, so it is checked before the image is decoded.
+	MaxPixels = 4096 * 4096
+	// MaxGifPixels bounds the summed area of all frames of a GIF. Frames
+	// take one byte per pixel where other images take four.
+	MaxGifPixels = 4 * MaxPixels
+
+	ThumbnailSize       = 256
+	blurhashComponentsX = 4
+	blurhashComponentsY = 3
+	blurhashSampleSize  = 32
+)
+
+// Result holds everything derived from an uploaded image.
+type Result struct {
+	// Original is the re-encoded upload. Re-encoding drops EXIF and any
+	// other metadata carried by the source file.
+	Original  []byte
+	Thumbnail []byte
+	Width     int
+	Height    int
+	Blurhash  string
+}
+
+// Process decodes a PNG, JPEG or GIF image and builds its stripped
+// original, a ThumbnailSize square PNG thumbnail and a blurhash placeholder.
+func Process(data []byte, contentType string) (Result, error) {
+	original, img, err := reencode(data, contentType)
+	if err != nil {
+		return Result{}, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return Result{}, errors.New("image has no pixels")
+	}
+
+	var thumbnail bytes.Buffer
+	err = png.Encode(&thumbnail, resize(cropSquare(img), ThumbnailSize, ThumbnailSize))
+	if err != nil {
+		return Result{}, err
+	}
+
+	sample := resize(img, blurhashSampleSize, blurhashSampleSize)
+	return Result{
+		Original:  original,
+		Thumbnail: thumbnail.Bytes(),
+		Width:     bounds.Dx(),
+		Height:    bounds.Dy(),
+		Blurhash:  Blurhash(sample, blurhashComponentsX, blurhashComponentsY),
+	}, nil
+}
+
+// checkSize rejects images whose decoded pixels would exceed the budget,
+// using only the header and, for GIFs, the frame count.
+func checkSize(data []byte, contentType string) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	area := config.Width * config.Height
+	if area > MaxPixels {
+		return fmt.Errorf("image is %dx%d, larger than %d pixels", config.Width, config.Height, MaxPixels)
+	}
+	if contentType != "image/gif" {
+		return nil
+	}
+	frames, err := gifFrameCount(data)
+	if err != nil {
+		return err
+	}
+	if frames*area > MaxGifPixels {
+		return fmt.Errorf("gif has %d frames of %dx%d, more than %d pixels", frames, config.Width, config.Height, MaxGifPixels)
+	}
+	return nil
+}
+
+func reencode(data []byte, contentType string) ([]byte, image.Image, error) {
+	err := checkSize(data, contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+	var out bytes.Buffer
+	switch contentType {
+	case "image/png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		err = png.Encode(&out, img)
+		return out.Bytes(), img, err
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+		return out.Bytes(), img, err
+	case "image/gif":
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(g.Image) == 0 {
+			return nil, nil, errors.New("gif has no frames")
+		}
+		err = gif.EncodeAll(&out, g)
+		return out.Bytes(), g.Image[0], err
+	}
+	return nil, nil, errors.New("unsupported content type: " + contentType)
+}
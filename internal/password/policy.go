@@ -0,0 +1,95 @@
+// Package password decides which passwords chirpy accepts for new and
+// changed credentials.
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const DefaultMinLength = 8
+
+// MaxBytes is the longest password bcrypt can hash. Longer ones would fail
+// when stored, so they are rejected here instead.
+const MaxBytes = 72
+
+type Policy struct {
+	MinLength int
+	// breached holds the upper case SHA-1 digests of known breached
+	// passwords.
+	breached map[string]struct{}
+}
+
+func NewPolicy(minLength int) *Policy {
+	return &Policy{
+		MinLength: minLength,
+		breached:  map[string]struct{}{},
+	}
+}
+
+// LoadBreachedList adds the passwords in the file to the breached list.
+// Each line is either a password or its SHA-1 digest in hex, optionally
+// followed by ":count" as in the Have I Been Pwned downloads. The list is
+// held in memory, so it is meant for lists of common passwords rather than
+// full breach corpora.
+func (p *Policy) LoadBreachedList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if digest, ok := parseDigest(line); ok {
+			p.breached[digest] = struct{}{}
+			continue
+		}
+		p.breached[digestOf(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Validate returns an error describing why the password is not allowed.
+// email is the address of the account the password is for.
+func (p *Policy) Validate(password string, email string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if len(password) > MaxBytes {
+		return fmt.Errorf("password must be at most %d bytes", MaxBytes)
+	}
+	if strings.EqualFold(password, email) {
+		return errors.New("password must not be the email address")
+	}
+	if _, ok := p.breached[digestOf(password)]; ok {
+		return errors.New("password appears in a list of breached passwords")
+	}
+	return nil
+}
+
+func digestOf(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func parseDigest(line string) (string, bool) {
+	digest, _, _ := strings.Cut(line, ":")
+	if len(digest) != sha1.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", false
+	}
+	return strings.ToUpper(digest), true
+}
@@ -0,0 +1,84 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	policy := NewPolicy(DefaultMinLength)
+	policy.breached[digestOf("password123")] = struct{}{}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		wantErr  bool
+	}{
+		{"acceptable", "correct-horse", "a@example.com", false},
+		{"too short", "short", "a@example.com", true},
+		{"short in bytes but not in characters", "ééééééé", "a@example.com", true},
+		{"multibyte at the minimum", "éééééééé", "a@example.com", false},
+		{"email address", "A@Example.com", "a@example.com", true},
+		{"breached", "password123", "a@example.com", true},
+		{"at the bcrypt limit", strings.Repeat("a", MaxBytes), "a@example.com", false},
+		{"over the bcrypt limit", strings.Repeat("a", MaxBytes+1), "a@example.com", true},
+		{"over the limit in bytes only", strings.Repeat("é", MaxBytes/2+1), "a@example.com", true},
+	}
+	for _, tt := range tests {
+		err := policy.Validate(tt.password, tt.email)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate(%q) = %v, want error %t", tt.name, tt.password, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadBreachedList(t *testing.T) {
+	// "hunter2" and "letmein" as SHA-1 digests, upper and lower case.
+	list := strings.Join([]string{
+		"F3BBBD66A63D4BF1747940578EC3D0103530E21D",
+		"b7a875fc1ea228b9061041b7cec4bd3c52ab3ce3:3541",
+		"",
+		"plain-password\r",
+		"not-a-digest:12",
+		"F3BBBD66A63D4BF1747940578EC3D0103530E21Z",
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(path, []byte(list), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NewPolicy(1)
+	err = policy.LoadBreachedList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		breached bool
+	}{
+		{"hunter2", true},
+		{"letmein", true},
+		{"plain-password", true},
+		{"not-a-digest:12", true},
+		{"F3BBBD66A63D4BF1747940578EC3D0103530E21Z", true},
+		{"not-a-digest", false},
+		{"something-else", false},
+	}
+	for _, tt := range tests {
+		_, ok := policy.breached[digestOf(tt.password)]
+		if ok != tt.breached {
+			t.Errorf("%q breached = %t, want %t", tt.password, ok, tt.breached)
+		}
+	}
+}
+
+func TestLoadBreachedListMissingFile(t *testing.T) {
+	err := NewPolicy(1).LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt"))
+	if err == nil {
+		t.Error("LoadBreachedList succeeded for a missing file")
+	}
+}
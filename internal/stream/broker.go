@@ -0,0 +1,101 @@
+// Package stream fans chirp events out to long-lived client connections
+// and keeps a bounded history so reconnecting clients can catch up.
+package stream
+
+import (
+	"sync"
+
+	"github.com/like2foxes/chirpy/internal/database"
+)
+
+// subscriberBuffer is how many messages may queue up for one subscriber
+// before it is considered too slow and dropped.
+const subscriberBuffer = 64
+
+type Message struct {
+	Id    uint64
+	Event string
+	Chirp database.Chirp
+}
+
+type Broker struct {
+	mux         *sync.Mutex
+	nextId      uint64
+	history     []Message
+	historySize int
+	subscribers map[chan Message]struct{}
+}
+
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		mux:         &sync.Mutex{},
+		nextId:      1,
+		historySize: historySize,
+		subscribers: map[chan Message]struct{}{},
+	}
+}
+
+// Publish assigns the next id to the message, records it in the history and
+// delivers it to every subscriber. Subscribers whose queue is full are
+// disconnected; they can resume with the last id they received.
+func (b *Broker) Publish(event string, chirp database.Chirp) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	msg := Message{Id: b.nextId, Event: event, Chirp: chirp}
+	b.nextId++
+	b.history = append(b.history, msg)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- msg:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber for live messages only. The channel
+// is closed when the subscriber is dropped or cancel is called.
+func (b *Broker) Subscribe() (<-chan Message, func()) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.subscribe()
+}
+
+// Resume is Subscribe for a client that reconnects: it also returns the
+// buffered messages newer than lastId.
+func (b *Broker) Resume(lastId uint64) ([]Message, <-chan Message, func()) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	replay := []Message{}
+	if lastId < b.nextId {
+		for _, msg := range b.history {
+			if msg.Id > lastId {
+				replay = append(replay, msg)
+			}
+		}
+	}
+	ch, cancel := b.subscribe()
+	return replay, ch, cancel
+}
+
+// subscribe must be called with the lock held.
+func (b *Broker) subscribe() (<-chan Message, func()) {
+	ch := make(chan Message, subscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+	cancel := func() {
+		b.mux.Lock()
+		defer b.mux.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
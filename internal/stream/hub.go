@@ -0,0 +1,83 @@
+package stream
+
+import (
+	"sync"
+)
+
+// Envelope is a payload for one of the channels a client can subscribe to.
+type Envelope struct {
+	Channel string
+	Data    []byte
+}
+
+// Client is one live connection of a user. Envelopes arrive on Send; it is
+// closed when the client is dropped for falling behind or unregistered.
+type Client struct {
+	UserId int
+	Send   chan Envelope
+}
+
+// Hub delivers per-user payloads to every connection the user has open.
+type Hub struct {
+	mux     *sync.Mutex
+	clients map[int]map[*Client]struct{}
+	buffer  int
+}
+
+func NewHub(buffer int) *Hub {
+	return &Hub{
+		mux:     &sync.Mutex{},
+		clients: map[int]map[*Client]struct{}{},
+		buffer:  buffer,
+	}
+}
+
+func (h *Hub) Register(userId int) *Client {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	client := &Client{
+		UserId: userId,
+		Send:   make(chan Envelope, h.buffer),
+	}
+	if h.clients[userId] == nil {
+		h.clients[userId] = map[*Client]struct{}{}
+	}
+	h.clients[userId][client] = struct{}{}
+	return client
+}
+
+func (h *Hub) Unregister(client *Client) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.remove(client)
+}
+
+// SendTo queues the envelope for every connection of the user without
+// blocking. Connections whose queue is full are dropped so one slow client
+// cannot hold up delivery to the others.
+func (h *Hub) SendTo(userId int, envelope Envelope) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for client := range h.clients[userId] {
+		select {
+		case client.Send <- envelope:
+		default:
+			h.remove(client)
+		}
+	}
+}
+
+func (h *Hub) remove(client *Client) {
+	clients, ok := h.clients[client.UserId]
+	if !ok {
+		return
+	}
+	if _, ok := clients[client]; !ok {
+		return
+	}
+	delete(clients, client)
+	close(client.Send)
+	if len(clients) == 0 {
+		delete(h.clients, client.UserId)
+	}
+}